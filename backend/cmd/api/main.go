@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -30,9 +32,12 @@ func main() {
 	}
 
 	// Create and start server
-	srv := server.NewServer(cfg, db)
+	srv, err := server.NewServer(cfg, db)
+	if err != nil {
+		log.Fatalf("Failed to create server: %v", err)
+	}
 	go func() {
-		if err := srv.Start(); err != nil {
+		if err := srv.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("Failed to start server: %v", err)
 		}
 	}()
@@ -2,7 +2,6 @@ package auth
 
 import (
 	"errors"
-	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -13,32 +12,41 @@ import (
 
 // JWTClaims represents the claims in a JWT token
 type JWTClaims struct {
-	UserID uuid.UUID `json:"user_id"`
-	Email  string    `json:"email"`
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	SessionID uuid.UUID `json:"sid"`
 	jwt.RegisteredClaims
 }
 
 // JWTService handles JWT operations
 type JWTService struct {
 	config *config.Config
+	keys   *KeySet
 }
 
-// NewJWTService creates a new JWT service
-func NewJWTService(cfg *config.Config) *JWTService {
+// NewJWTService creates a new JWT service, loading its signing keys
+func NewJWTService(cfg *config.Config) (*JWTService, error) {
+	keys, err := LoadKeySet(cfg.JWT)
+	if err != nil {
+		return nil, err
+	}
+
 	return &JWTService{
 		config: cfg,
-	}
+		keys:   keys,
+	}, nil
 }
 
-// GenerateToken generates a new JWT token for a user
-func (s *JWTService) GenerateToken(user *models.User) (string, error) {
+// GenerateToken generates a new JWT access token for a user's session
+func (s *JWTService) GenerateToken(user *models.User, sessionID uuid.UUID) (string, error) {
 	// Set expiration time
-	expirationTime := time.Now().Add(time.Duration(s.config.JWT.ExpiryMinutes) * time.Minute)
+	expirationTime := time.Now().Add(s.AccessTokenExpiry())
 
 	// Create claims
 	claims := &JWTClaims{
-		UserID: user.ID,
-		Email:  user.Email,
+		UserID:    user.ID,
+		Email:     user.Email,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -48,11 +56,8 @@ func (s *JWTService) GenerateToken(user *models.User) (string, error) {
 		},
 	}
 
-	// Create token with claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Sign token with secret key
-	tokenString, err := token.SignedString([]byte(s.config.JWT.Secret))
+	// Sign token with the active key
+	tokenString, err := s.keys.Sign(claims)
 	if err != nil {
 		return "", err
 	}
@@ -63,48 +68,78 @@ func (s *JWTService) GenerateToken(user *models.User) (string, error) {
 // ValidateToken validates a JWT token
 func (s *JWTService) ValidateToken(tokenString string) (*JWTClaims, error) {
 	// Parse token
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(s.config.JWT.Secret), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, s.keys.Keyfunc)
 
 	if err != nil {
 		return nil, err
 	}
 
-	// Validate token and extract claims
-	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
+	// Validate token and extract claims, tokens issued before sessions existed are rejected
+	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid && claims.SessionID != uuid.Nil {
 		return claims, nil
 	}
 
 	return nil, errors.New("invalid token")
 }
 
-// RefreshToken refreshes a JWT token
-func (s *JWTService) RefreshToken(tokenString string) (string, error) {
-	// Validate existing token
-	claims, err := s.ValidateToken(tokenString)
-	if err != nil {
-		return "", err
+// AccessTokenExpiry returns how long access tokens are valid
+func (s *JWTService) AccessTokenExpiry() time.Duration {
+	return time.Duration(s.config.JWT.ExpiryMinutes) * time.Minute
+}
+
+// JWKS returns the public keys tokens can be verified with
+func (s *JWTService) JWKS() map[string]interface{} {
+	return s.keys.JWKS()
+}
+
+// Purposes of single-purpose tokens
+const (
+	PurposeEmailVerification = "email_verification"
+)
+
+// PurposeClaims represents the claims in a single-purpose token, such as an email verification link
+type PurposeClaims struct {
+	Email   string `json:"email"`
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// GeneratePurposeToken generates a signed token that can only be used for purpose, bound to the user's current email
+func (s *JWTService) GeneratePurposeToken(user *models.User, purpose string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := &PurposeClaims{
+		Email:   user.Email,
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "papo-reto-api",
+			Subject:   user.ID.String(),
+		},
 	}
 
-	// Create a new token with the same claims but extended expiration
-	expirationTime := time.Now().Add(time.Duration(s.config.JWT.ExpiryMinutes) * time.Minute)
-	claims.ExpiresAt = jwt.NewNumericDate(expirationTime)
-	claims.IssuedAt = jwt.NewNumericDate(time.Now())
-	claims.NotBefore = jwt.NewNumericDate(time.Now())
+	return s.keys.Sign(claims)
+}
 
-	// Create new token with refreshed claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+// ValidatePurposeToken validates a single-purpose token
+func (s *JWTService) ValidatePurposeToken(tokenString, purpose string) (*PurposeClaims, error) {
+	// Parse token
+	token, err := jwt.ParseWithClaims(tokenString, &PurposeClaims{}, s.keys.Keyfunc)
 
-	// Sign token with secret key
-	newTokenString, err := token.SignedString([]byte(s.config.JWT.Secret))
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	// Validate token and extract claims
+	if claims, ok := token.Claims.(*PurposeClaims); ok && token.Valid && claims.Purpose == purpose {
+		return claims, nil
 	}
 
-	return newTokenString, nil
+	return nil, errors.New("invalid token")
+}
+
+// UserID returns the ID of the user the token was issued to
+func (c *PurposeClaims) UserID() (uuid.UUID, error) {
+	return uuid.Parse(c.Subject)
 }
@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ralfferreira/papo-reto/internal/config"
+)
+
+// SigningKey is a key tokens are signed or verified with
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	privateKey interface{} // *rsa.PrivateKey or ed25519.PrivateKey
+	publicKey  interface{} // *rsa.PublicKey or ed25519.PublicKey
+}
+
+// KeySet holds the keys tokens are verified with and the one new tokens are signed with.
+// Retired keys stay in the set so tokens they signed remain valid until they expire.
+type KeySet struct {
+	keys   map[string]*SigningKey
+	active *SigningKey
+}
+
+// LoadKeySet loads the signing keys from JWT_KEYS_DIR, where each PEM file holds an RSA
+// or Ed25519 private key named after its key ID. Without a keys directory, which is only
+// allowed outside production, an Ed25519 key is generated for the life of the process.
+func LoadKeySet(cfg config.JWTConfig) (*KeySet, error) {
+	if cfg.KeysDir == "" {
+		return generateKeySet()
+	}
+
+	paths, err := filepath.Glob(filepath.Join(cfg.KeysDir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no signing keys found in %s", cfg.KeysDir)
+	}
+
+	// Key IDs are the file names, by default the last one in order signs new tokens
+	sort.Strings(paths)
+
+	ks := &KeySet{keys: make(map[string]*SigningKey, len(paths))}
+	for _, path := range paths {
+		id := strings.TrimSuffix(filepath.Base(path), ".pem")
+
+		key, err := loadSigningKey(id, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load signing key %s: %w", path, err)
+		}
+
+		ks.keys[id] = key
+		ks.active = key
+	}
+
+	if cfg.ActiveKeyID != "" {
+		key, ok := ks.keys[cfg.ActiveKeyID]
+		if !ok {
+			return nil, fmt.Errorf("active signing key %q not found in %s", cfg.ActiveKeyID, cfg.KeysDir)
+		}
+		ks.active = key
+	}
+
+	return ks, nil
+}
+
+// Sign signs a token with the active key
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	token.Header["kid"] = ks.active.ID
+	return token.SignedString(ks.active.privateKey)
+}
+
+// Keyfunc returns the key a token must be verified with, its algorithm must match the key's
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %q", kid)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.publicKey, nil
+}
+
+// JWKS returns the public keys of the set as a JSON Web Key Set
+func (ks *KeySet) JWKS() map[string]interface{} {
+	ids := make([]string, 0, len(ks.keys))
+	for id := range ks.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	keys := make([]map[string]string, 0, len(ids))
+	for _, id := range ids {
+		key := ks.keys[id]
+
+		switch public := key.publicKey.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"kid": key.ID,
+				"use": "sig",
+				"alg": key.Method.Alg(),
+				"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, map[string]string{
+				"kty": "OKP",
+				"kid": key.ID,
+				"use": "sig",
+				"alg": key.Method.Alg(),
+				"crv": "Ed25519",
+				"x":   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+
+	return map[string]interface{}{"keys": keys}
+}
+
+// generateKeySet creates a set with a new Ed25519 key, tokens it signs stop being valid when the process exits
+func generateKeySet() (*KeySet, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{
+		ID:         "generated-" + hex.EncodeToString(public[:8]),
+		Method:     jwt.SigningMethodEdDSA,
+		privateKey: private,
+		publicKey:  public,
+	}
+	log.Printf("JWT_KEYS_DIR is not set, signing tokens with the generated key %s", key.ID)
+
+	return &KeySet{keys: map[string]*SigningKey{key.ID: key}, active: key}, nil
+}
+
+// loadSigningKey reads a PEM encoded RSA or Ed25519 private key
+func loadSigningKey(id, path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var privateKey crypto.PrivateKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must have at least 2048 bits")
+		}
+		return &SigningKey{ID: id, Method: jwt.SigningMethodRS256, privateKey: key, publicKey: &key.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, privateKey: key, publicKey: key.Public()}, nil
+	default:
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+}
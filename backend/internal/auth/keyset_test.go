@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ralfferreira/papo-reto/internal/config"
+)
+
+// writeKeys writes an RSA key and an Ed25519 key to a keys directory, named after their key IDs
+func writeKeys(t *testing.T, rsaID, ed25519ID string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	writePEM(t, filepath.Join(dir, rsaID+".pem"), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatalf("failed to encode Ed25519 key: %v", err)
+	}
+	writePEM(t, filepath.Join(dir, ed25519ID+".pem"), "PRIVATE KEY", der)
+
+	return dir
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+}
+
+// signTestToken signs a short-lived token with a key set
+func signTestToken(t *testing.T, ks *KeySet) string {
+	t.Helper()
+
+	token, err := ks.Sign(jwt.RegisteredClaims{Subject: "ana", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return token
+}
+
+// tokenKeyID returns the kid header of a token, without verifying it
+func tokenKeyID(t *testing.T, token string) string {
+	t.Helper()
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatalf("failed to parse token: %v", err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestKeySetSignsWithActiveKey(t *testing.T) {
+	dir := writeKeys(t, "2024-01", "2025-01")
+
+	tests := []struct {
+		name        string
+		activeKeyID string
+		wantKeyID   string
+		wantAlg     string
+	}{
+		{"last key by default", "", "2025-01", "EdDSA"},
+		{"configured key", "2024-01", "2024-01", "RS256"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks, err := LoadKeySet(config.JWTConfig{KeysDir: dir, ActiveKeyID: tt.activeKeyID})
+			if err != nil {
+				t.Fatalf("LoadKeySet: %v", err)
+			}
+
+			token := signTestToken(t, ks)
+			if kid := tokenKeyID(t, token); kid != tt.wantKeyID {
+				t.Errorf("kid = %q, want %q", kid, tt.wantKeyID)
+			}
+
+			parsed, err := jwt.Parse(token, ks.Keyfunc)
+			if err != nil {
+				t.Fatalf("failed to verify token: %v", err)
+			}
+			if parsed.Method.Alg() != tt.wantAlg {
+				t.Errorf("alg = %q, want %q", parsed.Method.Alg(), tt.wantAlg)
+			}
+		})
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	dir := writeKeys(t, "2024-01", "2025-01")
+
+	old, err := LoadKeySet(config.JWTConfig{KeysDir: dir, ActiveKeyID: "2024-01"})
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	token := signTestToken(t, old)
+
+	// Tokens signed before the rotation stay valid while the retired key is in the set
+	rotated, err := LoadKeySet(config.JWTConfig{KeysDir: dir})
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	if _, err := jwt.Parse(token, rotated.Keyfunc); err != nil {
+		t.Errorf("token of the retired key was rejected: %v", err)
+	}
+
+	// And stop being accepted once the key is removed
+	if err := os.Remove(filepath.Join(dir, "2024-01.pem")); err != nil {
+		t.Fatalf("failed to remove key: %v", err)
+	}
+	pruned, err := LoadKeySet(config.JWTConfig{KeysDir: dir})
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	if _, err := jwt.Parse(token, pruned.Keyfunc); err == nil {
+		t.Error("token of a removed key was accepted")
+	}
+}
+
+func TestKeySetRejectsForgedHeaders(t *testing.T) {
+	dir := writeKeys(t, "2024-01", "2025-01")
+	ks, err := LoadKeySet(config.JWTConfig{KeysDir: dir})
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+
+	claims := jwt.RegisteredClaims{Subject: "ana", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}
+
+	// An HMAC token keyed with public material must not pass for the RSA key
+	rsaPublic, err := x509.MarshalPKIXPublicKey(ks.keys["2024-01"].publicKey)
+	if err != nil {
+		t.Fatalf("failed to encode public key: %v", err)
+	}
+	hmacToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	hmacToken.Header["kid"] = "2024-01"
+	confused, err := hmacToken.SignedString(rsaPublic)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	// A token claiming a key ID that is not in the set
+	unknown := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	unknown.Header["kid"] = "2023-01"
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	unknownKey, err := unknown.SignedString(otherKey)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	// A token of the set with its kid pointing at the other key
+	swapped := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	swapped.Header["kid"] = "2024-01"
+	swappedKey, err := swapped.SignedString(ks.keys["2025-01"].privateKey)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	for name, token := range map[string]string{"algorithm confusion": confused, "unknown kid": unknownKey, "swapped kid": swappedKey} {
+		if _, err := jwt.Parse(token, ks.Keyfunc); err == nil {
+			t.Errorf("%s: forged token was accepted", name)
+		}
+	}
+}
+
+func TestLoadKeySetRequiresConfiguredActiveKey(t *testing.T) {
+	dir := writeKeys(t, "2024-01", "2025-01")
+
+	if _, err := LoadKeySet(config.JWTConfig{KeysDir: dir, ActiveKeyID: "2026-01"}); err == nil {
+		t.Error("LoadKeySet() accepted an active key that is not in the directory")
+	}
+	if _, err := LoadKeySet(config.JWTConfig{KeysDir: t.TempDir()}); err == nil {
+		t.Error("LoadKeySet() accepted an empty keys directory")
+	}
+}
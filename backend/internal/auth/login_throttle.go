@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/ralfferreira/papo-reto/internal/config"
+)
+
+// LoginThrottle tracks failed logins per account and per IP in Redis. Past a few free
+// attempts every failure imposes an exponentially growing delay, and too many failures
+// lock the account or IP for a while.
+type LoginThrottle struct {
+	redis *redis.Client
+	cfg   config.LoginConfig
+}
+
+// NewLoginThrottle creates a new login throttle
+func NewLoginThrottle(rdb *redis.Client, cfg config.LoginConfig) *LoginThrottle {
+	return &LoginThrottle{
+		redis: rdb,
+		cfg:   cfg,
+	}
+}
+
+// Check returns how long logins for an account from an IP must wait, zero if they are allowed
+func (t *LoginThrottle) Check(ctx context.Context, email, ip string) (time.Duration, error) {
+	keys := []string{
+		loginKey("ip", ip, "locked"),
+		loginKey("ip", ip, "backoff"),
+	}
+	if email != "" {
+		keys = append(keys,
+			loginKey("account", normalizeEmail(email), "locked"),
+			loginKey("account", normalizeEmail(email), "backoff"),
+		)
+	}
+
+	pipe := t.redis.Pipeline()
+	ttls := make([]*redis.DurationCmd, 0, len(keys))
+	for _, key := range keys {
+		ttls = append(ttls, pipe.PTTL(ctx, key))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	// PTTL is negative for missing keys
+	var wait time.Duration
+	for _, ttl := range ttls {
+		if ttl.Val() > wait {
+			wait = ttl.Val()
+		}
+	}
+
+	return wait, nil
+}
+
+// RecordFailure records a failed login for an account from an IP, email may be empty when
+// the account is unknown. It returns how long the next attempt must wait and whether the
+// account has just been locked.
+func (t *LoginThrottle) RecordFailure(ctx context.Context, email, ip string) (time.Duration, bool, error) {
+	wait, _, err := t.fail(ctx, "ip", ip, t.cfg.MaxIPFailures)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if email == "" {
+		return wait, false, nil
+	}
+
+	accountWait, locked, err := t.fail(ctx, "account", normalizeEmail(email), t.cfg.MaxAccountFailures)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if accountWait > wait {
+		wait = accountWait
+	}
+
+	return wait, locked, nil
+}
+
+// Reset clears the failures of an account after a successful login. The failures of the
+// IP are kept, otherwise an attacker could clear them by logging into their own account.
+func (t *LoginThrottle) Reset(ctx context.Context, email string) error {
+	email = normalizeEmail(email)
+	return t.redis.Del(ctx,
+		loginKey("account", email, "failures"),
+		loginKey("account", email, "backoff"),
+	).Err()
+}
+
+// fail counts a failure for a subject and applies the backoff or lockout it earns
+func (t *LoginThrottle) fail(ctx context.Context, kind, subject string, maxFailures int) (time.Duration, bool, error) {
+	failuresKey := loginKey(kind, subject, "failures")
+
+	failures, err := t.redis.Incr(ctx, failuresKey).Result()
+	if err != nil {
+		return 0, false, err
+	}
+	if failures == 1 {
+		if err := t.redis.Expire(ctx, failuresKey, t.cfg.FailureWindow).Err(); err != nil {
+			return 0, false, err
+		}
+	}
+
+	// Lock the subject, only the request that sets the lock reports it
+	if maxFailures > 0 && failures >= int64(maxFailures) {
+		locked, err := t.redis.SetNX(ctx, loginKey(kind, subject, "locked"), 1, t.cfg.LockoutDuration).Result()
+		if err != nil {
+			return 0, false, err
+		}
+		if err := t.redis.Del(ctx, failuresKey, loginKey(kind, subject, "backoff")).Err(); err != nil {
+			return 0, false, err
+		}
+		return t.cfg.LockoutDuration, locked, nil
+	}
+
+	if failures <= int64(t.cfg.FreeAttempts) {
+		return 0, false, nil
+	}
+
+	// Double the delay on every failure past the free attempts
+	delay := t.cfg.BaseDelay
+	for i := int64(t.cfg.FreeAttempts) + 1; i < failures && delay < t.cfg.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > t.cfg.MaxDelay {
+		delay = t.cfg.MaxDelay
+	}
+
+	if delay > 0 {
+		if err := t.redis.Set(ctx, loginKey(kind, subject, "backoff"), 1, delay).Err(); err != nil {
+			return 0, false, err
+		}
+	}
+
+	return delay, false, nil
+}
+
+// loginKey returns the Redis key of a login throttling counter
+func loginKey(kind, subject, name string) string {
+	return "papo-reto:login:" + kind + ":" + subject + ":" + name
+}
+
+// normalizeEmail folds an email so different spellings share counters
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
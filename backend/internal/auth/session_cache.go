@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// Cached states of a session
+const (
+	SessionStateUnknown = ""
+	SessionStateActive  = "active"
+	SessionStateRevoked = "revoked"
+)
+
+// SessionCache keeps the state of sessions in Redis so authenticating a request does not
+// need the database. Revoked entries only need to outlive the access tokens of the session,
+// active entries expire quickly so the session is looked up, and its last use recorded, again.
+type SessionCache struct {
+	redis      *redis.Client
+	revokedTTL time.Duration
+	activeTTL  time.Duration
+}
+
+// NewSessionCache creates a new session cache keeping revoked sessions for revokedTTL and active ones for activeTTL
+func NewSessionCache(rdb *redis.Client, revokedTTL, activeTTL time.Duration) *SessionCache {
+	return &SessionCache{
+		redis:      rdb,
+		revokedTTL: revokedTTL,
+		activeTTL:  activeTTL,
+	}
+}
+
+// MarkRevoked marks sessions as revoked
+func (c *SessionCache) MarkRevoked(ctx context.Context, sessionIDs ...uuid.UUID) error {
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+
+	pipe := c.redis.Pipeline()
+	for _, sessionID := range sessionIDs {
+		pipe.Set(ctx, sessionStateKey(sessionID), SessionStateRevoked, c.revokedTTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// MarkActive marks a session as active, unless it was revoked in the meantime
+func (c *SessionCache) MarkActive(ctx context.Context, sessionID uuid.UUID) error {
+	return c.redis.SetNX(ctx, sessionStateKey(sessionID), SessionStateActive, c.activeTTL).Err()
+}
+
+// State returns the cached state of a session, SessionStateUnknown if it is not cached
+func (c *SessionCache) State(ctx context.Context, sessionID uuid.UUID) (string, error) {
+	state, err := c.redis.Get(ctx, sessionStateKey(sessionID)).Result()
+	if err == redis.Nil {
+		return SessionStateUnknown, nil
+	}
+	return state, err
+}
+
+// sessionStateKey returns the Redis key holding the state of a session
+func sessionStateKey(sessionID uuid.UUID) string {
+	return "papo-reto:sessions:" + sessionID.String() + ":state"
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// ErrTicketNotFound is returned when a stream ticket is unknown, expired or already used
+var ErrTicketNotFound = errors.New("stream ticket not found")
+
+// TicketStore keeps the tickets that open realtime streams in Redis. Browsers cannot set headers
+// on WebSocket or EventSource requests, so the stream URL carries a ticket instead of the access
+// token: it is single use and short lived, so one read from an access log is worth nothing.
+// Only the hash of the ticket is stored.
+type TicketStore struct {
+	redis *redis.Client
+	ttl   time.Duration
+}
+
+// NewTicketStore creates a new ticket store keeping tickets for ttl
+func NewTicketStore(rdb *redis.Client, ttl time.Duration) *TicketStore {
+	return &TicketStore{
+		redis: rdb,
+		ttl:   ttl,
+	}
+}
+
+// TTL returns how long a ticket can be redeemed after it is issued
+func (s *TicketStore) TTL() time.Duration {
+	return s.ttl
+}
+
+// Create issues a ticket for the session an access token belongs to and returns it
+func (s *TicketStore) Create(ctx context.Context, claims *JWTClaims) (string, error) {
+	ticket, hash, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	key := ticketKey(hash)
+	if _, err := s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, "user_id", claims.UserID.String(), "email", claims.Email, "session_id", claims.SessionID.String())
+		pipe.Expire(ctx, key, s.ttl)
+		return nil
+	}); err != nil {
+		return "", err
+	}
+
+	return ticket, nil
+}
+
+// Redeem deletes a ticket and returns the claims it was issued for, only one caller can redeem it
+func (s *TicketStore) Redeem(ctx context.Context, ticket string) (*JWTClaims, error) {
+	key := ticketKey(HashToken(ticket))
+
+	var fields *redis.StringStringMapCmd
+	if _, err := s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		fields = pipe.HGetAll(ctx, key)
+		pipe.Del(ctx, key)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	values := fields.Val()
+	userID, err := uuid.Parse(values["user_id"])
+	if err != nil {
+		return nil, ErrTicketNotFound
+	}
+	sessionID, err := uuid.Parse(values["session_id"])
+	if err != nil {
+		return nil, ErrTicketNotFound
+	}
+
+	return &JWTClaims{UserID: userID, Email: values["email"], SessionID: sessionID}, nil
+}
+
+// ticketKey returns the Redis key of a ticket
+func ticketKey(hash string) string {
+	return "papo-reto:stream:tickets:" + hash
+}
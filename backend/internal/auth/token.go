@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// opaqueTokenBytes is the number of random bytes in an opaque token
+const opaqueTokenBytes = 32
+
+// APIKeyPrefix starts every API key, telling keys apart from access tokens
+const APIKeyPrefix = "pk_"
+
+// GenerateOpaqueToken generates a random URL-safe token and returns it with its hash
+func GenerateOpaqueToken() (string, string, error) {
+	b := make([]byte, opaqueTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hex encoded SHA-256 hash of a token, the form in which tokens are stored
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIKey checks if a bearer credential is an API key rather than an access token
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 secret of the RFC 6238 test vectors, "12345678901234567890" in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTPRFC6238Vectors(t *testing.T) {
+	// RFC 6238 Appendix B lists 8 digit codes, the 6 digit codes are their last 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		now := time.Unix(tt.unix, 0)
+		code := tt.code[len(tt.code)-totpDigits:]
+
+		if got, err := TOTPCode(rfc6238Secret, now); err != nil || got != code {
+			t.Errorf("TOTPCode(%d) = %q, %v, want %q", tt.unix, got, err, code)
+		}
+
+		step, ok := ValidateTOTP(rfc6238Secret, code, now)
+		if !ok || step != tt.unix/30 {
+			t.Errorf("ValidateTOTP(%q, %d) = %d, %v, want %d, true", code, tt.unix, step, ok, tt.unix/30)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, err := TOTPCode(rfc6238Secret, now)
+	if err != nil {
+		t.Fatalf("TOTPCode: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		offset time.Duration
+		want   bool
+	}{
+		{"same period", 0, true},
+		{"clock one period ahead", totpPeriod, true},
+		{"clock one period behind", -totpPeriod, true},
+		{"clock two periods ahead", 2 * totpPeriod, false},
+		{"clock two periods behind", -2 * totpPeriod, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(rfc6238Secret, code, now.Add(tt.offset))
+			if ok != tt.want {
+				t.Fatalf("ValidateTOTP() ok = %v, want %v", ok, tt.want)
+			}
+			// The step is the one the code was issued for, whatever the clock says
+			if ok && step != now.Unix()/30 {
+				t.Errorf("ValidateTOTP() step = %d, want %d", step, now.Unix()/30)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPRejectsMalformedCodes(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	for _, code := range []string{"", "5924", "0005924", "abcdef", "89005924"} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, now); ok {
+			t.Errorf("ValidateTOTP(%q) accepted a malformed code", code)
+		}
+	}
+
+	// The secret is read case-insensitively, as apps and users type it
+	if _, ok := ValidateTOTP(strings.ToLower(rfc6238Secret), "005924", now); !ok {
+		t.Error("ValidateTOTP() rejected a lowercase secret")
+	}
+	if _, ok := ValidateTOTP("not base32!", "005924", now); ok {
+		t.Error("ValidateTOTP() accepted an invalid secret")
+	}
+}
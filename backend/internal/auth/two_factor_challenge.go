@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// ErrChallengeNotFound is returned when a two-factor challenge is unknown, expired, used or out of attempts
+var ErrChallengeNotFound = errors.New("two-factor challenge not found")
+
+// ChallengeStore keeps the two-factor challenges issued after the password step in Redis.
+// A challenge is single use and takes a limited number of codes, so it cannot be replayed
+// or used to try every code while it is valid. Only the hash of the challenge token is stored.
+type ChallengeStore struct {
+	redis       *redis.Client
+	ttl         time.Duration
+	maxAttempts int64
+}
+
+// NewChallengeStore creates a new challenge store keeping challenges for ttl and accepting maxAttempts codes each
+func NewChallengeStore(rdb *redis.Client, ttl time.Duration, maxAttempts int) *ChallengeStore {
+	return &ChallengeStore{
+		redis:       rdb,
+		ttl:         ttl,
+		maxAttempts: int64(maxAttempts),
+	}
+}
+
+// Create issues a challenge for a user and returns its token
+func (s *ChallengeStore) Create(ctx context.Context, userID uuid.UUID) (string, error) {
+	token, hash, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	key := challengeKey(hash)
+	if _, err := s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, "user_id", userID.String(), "attempts", 0)
+		pipe.Expire(ctx, key, s.ttl)
+		return nil
+	}); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Get returns the user a challenge was issued to
+func (s *ChallengeStore) Get(ctx context.Context, token string) (uuid.UUID, error) {
+	value, err := s.redis.HGet(ctx, challengeKey(HashToken(token)), "user_id").Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return uuid.Nil, ErrChallengeNotFound
+		}
+		return uuid.Nil, err
+	}
+
+	userID, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, ErrChallengeNotFound
+	}
+	return userID, nil
+}
+
+// attemptScript counts an attempt on a challenge, if the challenge still exists.
+// It returns the number of attempts so far, or -1 for a missing challenge.
+var attemptScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+return redis.call('HINCRBY', KEYS[1], 'attempts', 1)
+`)
+
+// Attempt records a code entered for a challenge before it is checked and returns how many
+// attempts the challenge has left. Concurrent attempts are counted too, so a challenge never
+// checks more than maxAttempts codes; it is deleted once it has none left.
+func (s *ChallengeStore) Attempt(ctx context.Context, token string) (int64, error) {
+	key := challengeKey(HashToken(token))
+
+	attempts, err := attemptScript.Run(ctx, s.redis, []string{key}).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if attempts < 0 {
+		return 0, ErrChallengeNotFound
+	}
+
+	if attempts > s.maxAttempts {
+		if err := s.redis.Del(ctx, key).Err(); err != nil {
+			return 0, err
+		}
+		return 0, ErrChallengeNotFound
+	}
+
+	return s.maxAttempts - attempts, nil
+}
+
+// Consume deletes a challenge once it was passed or ran out of attempts, only one caller can consume it
+func (s *ChallengeStore) Consume(ctx context.Context, token string) error {
+	deleted, err := s.redis.Del(ctx, challengeKey(HashToken(token))).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrChallengeNotFound
+	}
+	return nil
+}
+
+// challengeKey returns the Redis key of a challenge
+func challengeKey(hash string) string {
+	return "papo-reto:2fa:challenges:" + hash
+}
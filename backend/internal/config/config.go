@@ -2,8 +2,10 @@ package config
 
 import (
 	"fmt"
+	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -11,11 +13,15 @@ import (
 
 // Config holds all configuration for the application
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Redis    RedisConfig
-	JWT      JWTConfig
-	App      AppConfig
+	Server    ServerConfig
+	Database  DatabaseConfig
+	Redis     RedisConfig
+	JWT       JWTConfig
+	RateLimit RateLimitConfig
+	Login     LoginConfig
+	Mail      MailConfig
+	OIDC      OIDCConfig
+	App       AppConfig
 }
 
 // ServerConfig holds server-specific configuration
@@ -46,14 +52,73 @@ type RedisConfig struct {
 
 // JWTConfig holds JWT-specific configuration
 type JWTConfig struct {
-	Secret        string
-	ExpiryMinutes int
+	KeysDir           string // Directory of PEM private keys named after their key ID
+	ActiveKeyID       string // Key new tokens are signed with, defaults to the last one by name
+	ExpiryMinutes     int
+	RefreshExpiryDays int
+}
+
+// RateLimitConfig holds the default limits of the public send endpoint and of the
+// endpoints that send emails to an address given in the request
+type RateLimitConfig struct {
+	PerIP           int
+	PerIPGroup      int
+	PerGroup        int
+	Window          time.Duration
+	EmailPerIP      int
+	EmailPerAddress int
+	EmailWindow     time.Duration
+	ReplyPerIP      int
+	ReplyPerThread  int
+	ReplyWindow     time.Duration
+}
+
+// LoginConfig holds the brute-force protection thresholds of the login endpoint
+type LoginConfig struct {
+	FreeAttempts       int           // Failures allowed before backoff starts
+	BaseDelay          time.Duration // Backoff after the first failure past FreeAttempts, doubled on each further failure
+	MaxDelay           time.Duration
+	MaxAccountFailures int // Failures on an account before it is locked
+	MaxIPFailures      int // Failures from an IP before it is locked
+	FailureWindow      time.Duration
+	LockoutDuration    time.Duration
+}
+
+// MailConfig holds mail-specific configuration
+type MailConfig struct {
+	Driver    string // smtp, file or memory
+	Host      string
+	Port      string
+	Username  string
+	Password  string
+	From      string
+	OutboxDir string // Directory the file driver writes emails to
+}
+
+// OIDCConfig holds the OpenID Connect providers users can sign in with
+type OIDCConfig struct {
+	Providers []OIDCProviderConfig
+}
+
+// OIDCProviderConfig holds the configuration of a single OpenID Connect provider
+type OIDCProviderConfig struct {
+	Name         string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // Frontend page receiving the authorization code
+	Scopes       []string
 }
 
 // AppConfig holds application-specific configuration
 type AppConfig struct {
-	Environment string
-	LogLevel    string
+	Environment         string
+	LogLevel            string
+	FrontendURL         string        // Base URL of the links sent by email
+	DeletionGracePeriod time.Duration // How long a deleted account can be restored before it is purged
+	ExportDir           string        // Where data export archives are written, shared by every instance
+	ExportLinkTTL       time.Duration // How long a data export can be downloaded
+	InstanceID          string        // Name of this instance, recorded on the data exports it builds
 }
 
 // LoadConfig loads configuration from environment variables
@@ -82,12 +147,55 @@ func LoadConfig() (*Config, error) {
 	redisDB, _ := strconv.Atoi(getEnv("REDIS_DB", "0"))
 
 	// JWT config
-	jwtSecret := getEnv("JWT_SECRET", "your-secret-key")
-	jwtExpiryMinutes, _ := strconv.Atoi(getEnv("JWT_EXPIRY_MINUTES", "60"))
+	jwtKeysDir := getEnv("JWT_KEYS_DIR", "")
+	jwtActiveKeyID := getEnv("JWT_ACTIVE_KEY_ID", "")
+	jwtExpiryMinutes, _ := strconv.Atoi(getEnv("JWT_EXPIRY_MINUTES", "15"))
+	jwtRefreshExpiryDays, _ := strconv.Atoi(getEnv("JWT_REFRESH_EXPIRY_DAYS", "30"))
+
+	// Rate limit config
+	rateLimitPerIP := getPositiveEnvInt("RATE_LIMIT_PER_IP", 30)
+	rateLimitPerIPGroup := getPositiveEnvInt("RATE_LIMIT_PER_IP_GROUP", 5)
+	rateLimitPerGroup := getPositiveEnvInt("RATE_LIMIT_PER_GROUP", 300)
+	rateLimitWindow := getPositiveEnvInt("RATE_LIMIT_WINDOW_SECONDS", 60)
+	rateLimitEmailPerIP := getPositiveEnvInt("RATE_LIMIT_EMAIL_PER_IP", 10)
+	rateLimitEmailPerAddress := getPositiveEnvInt("RATE_LIMIT_EMAIL_PER_ADDRESS", 3)
+	rateLimitEmailWindow := getPositiveEnvInt("RATE_LIMIT_EMAIL_WINDOW_SECONDS", 3600)
+	rateLimitReplyPerIP := getPositiveEnvInt("RATE_LIMIT_REPLY_PER_IP", 30)
+	rateLimitReplyPerThread := getPositiveEnvInt("RATE_LIMIT_REPLY_PER_THREAD", 10)
+	rateLimitReplyWindow := getPositiveEnvInt("RATE_LIMIT_REPLY_WINDOW_SECONDS", 600)
+
+	// Login config
+	loginFreeAttempts := getPositiveEnvInt("LOGIN_FREE_ATTEMPTS", 3)
+	loginBaseDelay := getPositiveEnvInt("LOGIN_BASE_DELAY_SECONDS", 1)
+	loginMaxDelay := getPositiveEnvInt("LOGIN_MAX_DELAY_SECONDS", 300)
+	loginMaxAccountFailures := getPositiveEnvInt("LOGIN_MAX_ACCOUNT_FAILURES", 10)
+	loginMaxIPFailures := getPositiveEnvInt("LOGIN_MAX_IP_FAILURES", 50)
+	loginFailureWindow := getPositiveEnvInt("LOGIN_FAILURE_WINDOW_MINUTES", 15)
+	loginLockoutDuration := getPositiveEnvInt("LOGIN_LOCKOUT_MINUTES", 15)
+
+	// Mail config
+	mailDriver := getEnv("MAIL_DRIVER", "file")
+	mailHost := getEnv("MAIL_HOST", "localhost")
+	mailPort := getEnv("MAIL_PORT", "587")
+	mailUsername := getEnv("MAIL_USERNAME", "")
+	mailPassword := getEnv("MAIL_PASSWORD", "")
+	mailFrom := getEnv("MAIL_FROM", "Papo Reto <no-reply@papo-reto.local>")
+	mailOutboxDir := getEnv("MAIL_OUTBOX_DIR", "./tmp/outbox")
 
 	// App config
 	environment := getEnv("APP_ENV", "development")
 	logLevel := getEnv("LOG_LEVEL", "info")
+	frontendURL := getEnv("FRONTEND_URL", "http://localhost:3000")
+	deletionGraceDays, _ := strconv.Atoi(getEnv("ACCOUNT_DELETION_GRACE_DAYS", "14"))
+	exportDir := getEnv("EXPORT_DIR", "./tmp/exports")
+	exportLinkTTL, _ := strconv.Atoi(getEnv("EXPORT_LINK_TTL_HOURS", "48"))
+	hostname, _ := os.Hostname()
+	instanceID := getEnv("INSTANCE_ID", hostname)
+
+	// Without a keys directory a key is generated at every start, logging everyone out
+	if environment == "production" && jwtKeysDir == "" {
+		return nil, fmt.Errorf("JWT_KEYS_DIR must be set when APP_ENV=production")
+	}
 
 	return &Config{
 		Server: ServerConfig{
@@ -111,16 +219,78 @@ func LoadConfig() (*Config, error) {
 			DB:       redisDB,
 		},
 		JWT: JWTConfig{
-			Secret:        jwtSecret,
-			ExpiryMinutes: jwtExpiryMinutes,
+			KeysDir:           jwtKeysDir,
+			ActiveKeyID:       jwtActiveKeyID,
+			ExpiryMinutes:     jwtExpiryMinutes,
+			RefreshExpiryDays: jwtRefreshExpiryDays,
+		},
+		RateLimit: RateLimitConfig{
+			PerIP:           rateLimitPerIP,
+			PerIPGroup:      rateLimitPerIPGroup,
+			PerGroup:        rateLimitPerGroup,
+			Window:          time.Duration(rateLimitWindow) * time.Second,
+			EmailPerIP:      rateLimitEmailPerIP,
+			EmailPerAddress: rateLimitEmailPerAddress,
+			EmailWindow:     time.Duration(rateLimitEmailWindow) * time.Second,
+			ReplyPerIP:      rateLimitReplyPerIP,
+			ReplyPerThread:  rateLimitReplyPerThread,
+			ReplyWindow:     time.Duration(rateLimitReplyWindow) * time.Second,
 		},
+		Login: LoginConfig{
+			FreeAttempts:       loginFreeAttempts,
+			BaseDelay:          time.Duration(loginBaseDelay) * time.Second,
+			MaxDelay:           time.Duration(loginMaxDelay) * time.Second,
+			MaxAccountFailures: loginMaxAccountFailures,
+			MaxIPFailures:      loginMaxIPFailures,
+			FailureWindow:      time.Duration(loginFailureWindow) * time.Minute,
+			LockoutDuration:    time.Duration(loginLockoutDuration) * time.Minute,
+		},
+		Mail: MailConfig{
+			Driver:    mailDriver,
+			Host:      mailHost,
+			Port:      mailPort,
+			Username:  mailUsername,
+			Password:  mailPassword,
+			From:      mailFrom,
+			OutboxDir: mailOutboxDir,
+		},
+		OIDC: loadOIDCConfig(frontendURL),
 		App: AppConfig{
-			Environment: environment,
-			LogLevel:    logLevel,
+			Environment:         environment,
+			LogLevel:            logLevel,
+			FrontendURL:         frontendURL,
+			DeletionGracePeriod: time.Duration(deletionGraceDays) * 24 * time.Hour,
+			ExportDir:           exportDir,
+			ExportLinkTTL:       time.Duration(exportLinkTTL) * time.Hour,
+			InstanceID:          instanceID,
 		},
 	}, nil
 }
 
+// loadOIDCConfig loads the providers listed in OIDC_PROVIDERS, each one is configured
+// with variables prefixed by its upper-cased name, e.g. OIDC_GOOGLE_CLIENT_ID
+func loadOIDCConfig(frontendURL string) OIDCConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range strings.Split(getEnv("OIDC_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providers = append(providers, OIDCProviderConfig{
+			Name:         name,
+			IssuerURL:    getEnv(prefix+"ISSUER_URL", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", strings.TrimSuffix(frontendURL, "/")+"/auth/oidc/"+name+"/callback"),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "openid email profile")),
+		})
+	}
+
+	return OIDCConfig{Providers: providers}
+}
+
 // GetDSN returns the database connection string
 func (c *DatabaseConfig) GetDSN() string {
 	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
@@ -140,3 +310,20 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+// getPositiveEnvInt gets an environment variable holding a positive integer or returns a default
+// value. A zero, negative or malformed value would disable or break what it configures, so it is
+// logged and replaced by the default.
+func getPositiveEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 1 {
+		log.Printf("Invalid %s %q, using the default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return number
+}
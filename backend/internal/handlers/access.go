@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/services"
+)
+
+// authorizeGroup checks if the authenticated user can perform an action on a group.
+// It writes the error response and returns false when the user cannot.
+func authorizeGroup(c *gin.Context, policy *services.AccessPolicy, groupID uuid.UUID, action services.Action) (*models.MessageGroup, bool) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return nil, false
+	}
+
+	group, err := policy.Authorize(groupID, userID.(uuid.UUID), action)
+	if err != nil {
+		writeAccessError(c, err)
+		return nil, false
+	}
+
+	return group, true
+}
+
+// authorizeMessage checks if the authenticated user can perform an action on the group of a message.
+// It writes the error response and returns false when the user cannot.
+func authorizeMessage(c *gin.Context, policy *services.AccessPolicy, messageID uuid.UUID, action services.Action) (*models.Message, bool) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return nil, false
+	}
+
+	message, err := policy.AuthorizeMessage(messageID, userID.(uuid.UUID), action)
+	if err != nil {
+		writeAccessError(c, err)
+		return nil, false
+	}
+
+	return message, true
+}
+
+// authorizeSharedAccess checks if the authenticated user can perform an action on a shared access of a group.
+// It writes the error response and returns false when the user cannot.
+func authorizeSharedAccess(c *gin.Context, policy *services.AccessPolicy, groupID, shareID uuid.UUID, action services.Action) (*models.SharedAccess, bool) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return nil, false
+	}
+
+	access, err := policy.AuthorizeSharedAccess(groupID, shareID, userID.(uuid.UUID), action)
+	if err != nil {
+		writeAccessError(c, err)
+		return nil, false
+	}
+
+	return access, true
+}
+
+// writeAccessError writes the response for an access policy error. Resources the user
+// cannot see are reported as not found, 403 is only used when the user can see them.
+func writeAccessError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrAccessDenied):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrGroupNotFound),
+		errors.Is(err, services.ErrMessageNotFound),
+		errors.Is(err, services.ErrSharedAccessNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
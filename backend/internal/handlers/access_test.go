@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/realtime"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+	"github.com/ralfferreira/papo-reto/internal/services"
+	"github.com/ralfferreira/papo-reto/internal/testdb"
+	"gorm.io/gorm"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// tenantFixture holds the resources of user A, which user B must not reach
+type tenantFixture struct {
+	db      *gorm.DB
+	router  *gin.Engine
+	userA   uuid.UUID
+	userB   uuid.UUID
+	group   *models.MessageGroup
+	message *models.Message
+	share   *models.SharedAccess
+}
+
+func newTenantFixture(t *testing.T) *tenantFixture {
+	t.Helper()
+
+	db := testdb.New(t)
+	f := &tenantFixture{
+		db:    db,
+		userA: uuid.New(),
+		userB: uuid.New(),
+	}
+
+	f.group = testdb.Group(t, db, f.userA, "grupo-a")
+
+	// B owns a group too, so B is a regular user rather than one without any access
+	testdb.Group(t, db, f.userB, "grupo-b")
+
+	f.message = testdb.Message(t, db, f.group.ID, "segredo", models.ModerationStatusApproved)
+
+	f.share = &models.SharedAccess{GroupID: f.group.ID, InvitedBy: f.userA, Email: "c@example.com", Token: uuid.NewString(), Role: models.RoleViewer}
+	testdb.Create(t, db, f.share)
+
+	messageRepo := repository.NewMessageRepository(db)
+	sharedAccessRepo := repository.NewSharedAccessRepository(db)
+	policy := services.NewAccessPolicy(repository.NewMessageGroupRepository(db), messageRepo, sharedAccessRepo)
+
+	// Publishing to the unreachable Redis of the tests is logged on every write
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", DialTimeout: 10 * time.Millisecond, MaxRetries: -1})
+	t.Cleanup(func() { rdb.Close() })
+	hub := realtime.NewHub(rdb)
+
+	// The authenticated user is taken from the X-User-ID header in place of the auth middleware
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if userID, err := uuid.Parse(c.GetHeader("X-User-ID")); err == nil {
+			c.Set("userID", userID)
+		}
+		c.Next()
+	})
+	router.GET("/groups/:id/messages", GetMessages(messageRepo, policy))
+	router.PUT("/messages/:id", UpdateMessage(messageRepo, policy, hub))
+	router.DELETE("/messages/:id", DeleteMessage(messageRepo, policy, hub))
+	router.GET("/groups/:id/shared", GetSharedAccess(sharedAccessRepo, policy))
+	router.DELETE("/groups/:id/share/:shareId", RevokeSharedAccess(sharedAccessRepo, policy))
+	f.router = router
+
+	return f
+}
+
+// do performs a request as a user and returns the response
+func (f *tenantFixture) do(method, path, body string, userID uuid.UUID) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", userID.String())
+
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	return w
+}
+
+// requests lists the endpoints on A's resources, built for a fixture
+func (f *tenantFixture) requests() []struct {
+	name, method, path, body string
+} {
+	return []struct {
+		name, method, path, body string
+	}{
+		{"GetMessages", http.MethodGet, "/groups/" + f.group.ID.String() + "/messages", ""},
+		{"GetMessages pending", http.MethodGet, "/groups/" + f.group.ID.String() + "/messages?status=pending", ""},
+		{"UpdateMessage", http.MethodPut, "/messages/" + f.message.ID.String(), `{"isFavorite": true}`},
+		{"DeleteMessage", http.MethodDelete, "/messages/" + f.message.ID.String(), ""},
+		{"GetSharedAccess", http.MethodGet, "/groups/" + f.group.ID.String() + "/shared", ""},
+		{"RevokeSharedAccess", http.MethodDelete, "/groups/" + f.group.ID.String() + "/share/" + f.share.ID.String(), ""},
+	}
+}
+
+func TestCrossTenantAccessIsBlocked(t *testing.T) {
+	f := newTenantFixture(t)
+
+	for _, r := range f.requests() {
+		t.Run(r.name, func(t *testing.T) {
+			w := f.do(r.method, r.path, r.body, f.userB)
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("status = %d, want %d (body: %s)", w.Code, http.StatusNotFound, w.Body.String())
+			}
+			if strings.Contains(w.Body.String(), "segredo") {
+				t.Errorf("response leaks the content of A's message: %s", w.Body.String())
+			}
+		})
+	}
+
+	// Nothing of A's was changed
+	var message models.Message
+	if err := f.db.First(&message, "id = ?", f.message.ID).Error; err != nil {
+		t.Fatalf("A's message is gone: %v", err)
+	}
+	if message.IsFavorite {
+		t.Error("B favorited A's message")
+	}
+
+	var share models.SharedAccess
+	if err := f.db.First(&share, "id = ?", f.share.ID).Error; err != nil {
+		t.Fatalf("A's shared access is gone: %v", err)
+	}
+	if !share.IsActive {
+		t.Error("B revoked A's shared access")
+	}
+}
+
+func TestCrossTenantSharedAccessOfAnotherGroupIsBlocked(t *testing.T) {
+	f := newTenantFixture(t)
+
+	// B passes their own group in the URL with the ID of A's shared access
+	var groupB models.MessageGroup
+	if err := f.db.First(&groupB, "user_id = ?", f.userB).Error; err != nil {
+		t.Fatalf("failed to get B's group: %v", err)
+	}
+
+	w := f.do(http.MethodDelete, "/groups/"+groupB.ID.String()+"/share/"+f.share.ID.String(), "", f.userB)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d (body: %s)", w.Code, http.StatusNotFound, w.Body.String())
+	}
+
+	var share models.SharedAccess
+	if err := f.db.First(&share, "id = ?", f.share.ID).Error; err != nil {
+		t.Fatalf("A's shared access is gone: %v", err)
+	}
+	if !share.IsActive {
+		t.Error("B revoked A's shared access")
+	}
+}
+
+func TestOwnerAccessIsAllowed(t *testing.T) {
+	// The same requests made by A succeed, so the 404s above come from the access policy.
+	// Each request gets a fresh fixture since some of them delete what the others read.
+	for i := range newTenantFixture(t).requests() {
+		f := newTenantFixture(t)
+		r := f.requests()[i]
+
+		t.Run(r.name, func(t *testing.T) {
+			w := f.do(r.method, r.path, r.body, f.userA)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (body: %s)", w.Code, http.StatusOK, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/services"
+)
+
+// AccountHandler handles users deleting their own account
+type AccountHandler struct {
+	accountDeletionService *services.AccountDeletionService
+}
+
+// NewAccountHandler creates a new account handler
+func NewAccountHandler(accountDeletionService *services.AccountDeletionService) *AccountHandler {
+	return &AccountHandler{
+		accountDeletionService: accountDeletionService,
+	}
+}
+
+// DeleteAccount handles scheduling the deletion of the user's account
+func (h *AccountHandler) DeleteAccount(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Parse request
+	var req struct {
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Schedule deletion
+	user, err := h.accountDeletionService.ScheduleDeletion(c.Request.Context(), userID.(uuid.UUID), req.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidPassword):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrDeletionAlreadyScheduled):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":              "account deletion scheduled",
+		"deletionScheduledFor": user.DeletionScheduledFor,
+	})
+}
+
+// CancelDeletion handles cancelling the scheduled deletion of the user's account
+func (h *AccountHandler) CancelDeletion(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Cancel deletion
+	if err := h.accountDeletionService.CancelDeletion(userID.(uuid.UUID)); err != nil {
+		if errors.Is(err, services.ErrDeletionNotScheduled) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "account deletion cancelled"})
+}
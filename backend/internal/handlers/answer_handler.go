@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/realtime"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+	"github.com/ralfferreira/papo-reto/internal/services"
+)
+
+// publicAnswerResponse converts an answered message to its public format, which leaves out
+// everything about the sender and the inbox state
+func publicAnswerResponse(message *models.Message) gin.H {
+	return gin.H{
+		"id":         message.ID,
+		"icebreaker": message.Icebreaker,
+		"content":    message.Content,
+		"answer":     message.Answer,
+		"answeredAt": message.AnsweredAt,
+		"createdAt":  message.CreatedAt,
+	}
+}
+
+// encodeAnswerCursor encodes the position of an answered message in the public answers page
+func encodeAnswerCursor(message *models.Message) string {
+	raw := strconv.FormatInt(message.AnsweredAt.UnixNano(), 10) + "_" + message.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeAnswerCursor decodes a cursor made by encodeAnswerCursor
+func decodeAnswerCursor(cursor string) (time.Time, uuid.UUID, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, false
+	}
+
+	nanos, id, found := strings.Cut(string(raw), "_")
+	if !found {
+		return time.Time{}, uuid.Nil, false
+	}
+
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, uuid.Nil, false
+	}
+
+	messageID, err := uuid.Parse(id)
+	if err != nil {
+		return time.Time{}, uuid.Nil, false
+	}
+
+	return time.Unix(0, n), messageID, true
+}
+
+// AnswerMessage returns a handler for answering a message
+func AnswerMessage(messageRepo *repository.MessageRepository, policy *services.AccessPolicy, hub *realtime.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Get user ID from context
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		// Get message ID from URL
+		messageID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+			return
+		}
+
+		// Parse request
+		var req struct {
+			Answer   string `json:"answer" binding:"required,max=2000"`
+			IsPublic bool   `json:"isPublic"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Get message, checking if user can answer messages of its group
+		message, ok := authorizeMessage(c, policy, messageID, services.ActionAnswerMessages)
+		if !ok {
+			return
+		}
+
+		// Only messages in the inbox can be answered
+		if message.ModerationStatus != models.ModerationStatusApproved {
+			c.JSON(http.StatusConflict, gin.H{"error": "only approved messages can be answered"})
+			return
+		}
+
+		// Answer message
+		message.SetAnswer(strings.TrimSpace(req.Answer), userID.(uuid.UUID), req.IsPublic)
+
+		if err := messageRepo.UpdateAnswer(message); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Notify subscribers of the group
+		publishMessageEvent(c, hub, realtime.EventMessageUpdated, message, messageResponse(message))
+
+		c.JSON(http.StatusOK, gin.H{"message": messageResponse(message)})
+	}
+}
+
+// DeleteAnswer returns a handler for removing the answer of a message
+func DeleteAnswer(messageRepo *repository.MessageRepository, policy *services.AccessPolicy, hub *realtime.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Get user ID from context
+		_, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		// Get message ID from URL
+		messageID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+			return
+		}
+
+		// Get message, checking if user can answer messages of its group
+		message, ok := authorizeMessage(c, policy, messageID, services.ActionAnswerMessages)
+		if !ok {
+			return
+		}
+
+		if !message.IsAnswered() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "message has no answer"})
+			return
+		}
+
+		// Remove answer
+		message.ClearAnswer()
+
+		if err := messageRepo.UpdateAnswer(message); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Notify subscribers of the group
+		publishMessageEvent(c, hub, realtime.EventMessageUpdated, message, messageResponse(message))
+
+		c.JSON(http.StatusOK, gin.H{"message": "answer removed successfully"})
+	}
+}
+
+// GetPublicAnswers returns a handler for listing the public answers of a public group
+func GetPublicAnswers(messageRepo *repository.MessageRepository, groupRepo *repository.MessageGroupRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Get group by slug, private groups are reported as missing
+		group, err := groupRepo.GetBySlug(c.Param("slug"))
+		if err != nil || !group.IsPublic {
+			c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+			return
+		}
+
+		// Get pagination parameters
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if limit < 1 || limit > 100 {
+			limit = 20
+		}
+
+		var afterTime *time.Time
+		var afterID uuid.UUID
+		if cursor := c.Query("cursor"); cursor != "" {
+			t, id, ok := decodeAnswerCursor(cursor)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+				return
+			}
+			afterTime, afterID = &t, id
+		}
+
+		// Get one more answer than asked for to know if there is a next page
+		messages, err := messageRepo.GetPublicAnswers(group.ID, afterTime, afterID, limit+1)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var nextCursor *string
+		if len(messages) > limit {
+			messages = messages[:limit]
+			cursor := encodeAnswerCursor(&messages[limit-1])
+			nextCursor = &cursor
+		}
+
+		// Convert to response format
+		response := make([]gin.H, 0, len(messages))
+		for i := range messages {
+			response = append(response, publicAnswerResponse(&messages[i]))
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"answers":    response,
+			"nextCursor": nextCursor,
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/services"
+)
+
+// APIKeyHandler handles personal API keys
+type APIKeyHandler struct {
+	apiKeyService *services.APIKeyService
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(apiKeyService *services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+	}
+}
+
+// CreateAPIKey handles creating an API key
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Parse request
+	var req struct {
+		Name   string   `json:"name" binding:"required,max=100"`
+		Scopes []string `json:"scopes" binding:"required,min=1"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Create key
+	key, value, err := h.apiKeyService.CreateKey(userID.(uuid.UUID), req.Name, req.Scopes)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAPIKeyScope) || errors.Is(err, services.ErrAPIKeyLimitReached) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The key is only shown once
+	response := apiKeyResponse(key)
+	response["key"] = value
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetAPIKeys handles listing the user's API keys
+func (h *APIKeyHandler) GetAPIKeys(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Get keys
+	keys, err := h.apiKeyService.GetKeys(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Convert to response format
+	response := make([]gin.H, 0, len(keys))
+	for i := range keys {
+		response = append(response, apiKeyResponse(&keys[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"apiKeys": response})
+}
+
+// RevokeAPIKey handles revoking an API key
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Get key ID from URL
+	keyID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid API key ID"})
+		return
+	}
+
+	// Revoke key
+	if err := h.apiKeyService.RevokeKey(userID.(uuid.UUID), keyID); err != nil {
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
+
+// apiKeyResponse converts an API key to the response format, without its hash
+func apiKeyResponse(key *models.APIKey) gin.H {
+	return gin.H{
+		"id":         key.ID,
+		"name":       key.Name,
+		"prefix":     key.Prefix,
+		"scopes":     key.GetScopes(),
+		"lastUsedAt": key.LastUsedAt,
+		"createdAt":  key.CreatedAt,
+	}
+}
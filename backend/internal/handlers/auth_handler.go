@@ -1,21 +1,39 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/models"
 	"github.com/ralfferreira/papo-reto/internal/services"
 )
 
 // AuthHandler handles authentication requests
 type AuthHandler struct {
-	userService *services.UserService
+	userService          *services.UserService
+	sessionService       *services.SessionService
+	verificationService  *services.VerificationService
+	passwordResetService *services.PasswordResetService
+	twoFactorService     *services.TwoFactorService
+	loginGuard           *services.LoginGuard
 }
 
 // NewAuthHandler creates a new auth handler
-func NewAuthHandler(userService *services.UserService) *AuthHandler {
+func NewAuthHandler(userService *services.UserService, sessionService *services.SessionService, verificationService *services.VerificationService, passwordResetService *services.PasswordResetService, twoFactorService *services.TwoFactorService, loginGuard *services.LoginGuard) *AuthHandler {
 	return &AuthHandler{
-		userService: userService,
+		userService:          userService,
+		sessionService:       sessionService,
+		verificationService:  verificationService,
+		passwordResetService: passwordResetService,
+		twoFactorService:     twoFactorService,
+		loginGuard:           loginGuard,
 	}
 }
 
@@ -40,6 +58,14 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	// Send verification email in the background so a slow mail server does not hold the
+	// response, the user can ask for a new one if it fails
+	go func(user *models.User) {
+		if err := h.verificationService.SendVerification(context.Background(), user); err != nil {
+			log.Printf("Failed to send verification email: %v", err)
+		}
+	}(user)
+
 	// Return user without password
 	c.JSON(http.StatusCreated, gin.H{
 		"id":         user.ID,
@@ -64,19 +90,122 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Login user
-	token, err := h.userService.LoginUser(req.Email, req.Password)
+	// Refuse attempts while the account or IP is backing off or locked
+	ctx := c.Request.Context()
+	if wait := h.loginGuard.Check(ctx, req.Email, c.ClientIP()); wait > 0 {
+		tooManyLoginAttempts(c, wait)
+		return
+	}
+
+	// Authenticate user
+	user, err := h.userService.AuthenticateUser(req.Email, req.Password)
 	if err != nil {
+		if wait := h.loginGuard.RecordFailure(ctx, req.Email, c.ClientIP()); wait > 0 {
+			c.Header("Retry-After", retryAfterSeconds(wait))
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Return token
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	// Failures of accounts with two-factor authentication are cleared once the code is entered,
+	// so the password alone does not reset the codes guessed so far
+	if !user.TOTPEnabled {
+		h.loginGuard.RecordSuccess(ctx, req.Email)
+	}
+
+	startSession(c, h.sessionService, h.twoFactorService, user)
+}
+
+// VerifyTwoFactor handles the second step of the login of users with two-factor authentication enabled
+func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
+	// Parse request
+	var req struct {
+		ChallengeToken string `json:"challengeToken" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get challenge
+	ctx := c.Request.Context()
+	challenge, err := h.twoFactorService.GetChallenge(ctx, req.ChallengeToken)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidChallenge) {
+			if wait := h.loginGuard.RecordFailure(ctx, "", c.ClientIP()); wait > 0 {
+				c.Header("Retry-After", retryAfterSeconds(wait))
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Codes are throttled per account and IP like passwords
+	email := challenge.User.Email
+	if wait := h.loginGuard.Check(ctx, email, c.ClientIP()); wait > 0 {
+		tooManyLoginAttempts(c, wait)
+		return
+	}
+
+	// Check code
+	if err := h.twoFactorService.CompleteChallenge(ctx, challenge, req.Code); err != nil {
+		if errors.Is(err, services.ErrInvalidChallenge) || errors.Is(err, services.ErrInvalidTwoFactorCode) {
+			if wait := h.loginGuard.RecordFailure(ctx, email, c.ClientIP()); wait > 0 {
+				c.Header("Retry-After", retryAfterSeconds(wait))
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.loginGuard.RecordSuccess(ctx, email)
+
+	// Start session
+	tokens, err := h.sessionService.CreateSession(challenge.User, clientInfo(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Return tokens
+	c.JSON(http.StatusOK, tokenResponse(tokens))
 }
 
-// RefreshToken handles token refresh
+// RefreshToken handles token refresh, the refresh token is rotated on every use
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
+	// Parse request
+	var req struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Refresh tokens
+	tokens, err := h.sessionService.Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Return new tokens
+	c.JSON(http.StatusOK, tokenResponse(tokens))
+}
+
+// VerifyEmail handles confirming a user's email with a verification token
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
 	// Parse request
 	var req struct {
 		Token string `json:"token" binding:"required"`
@@ -87,13 +216,182 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	// Refresh token
-	newToken, err := h.userService.RefreshToken(req.Token)
+	// Verify email
+	user, err := h.verificationService.Verify(req.Token)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "email verified successfully",
+		"isVerified": user.IsVerified,
+	})
+}
+
+// ResendVerification handles sending a new verification email
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	// Parse request
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Send the email in the background so the response time does not reveal whether the account exists
+	go func(email string) {
+		if err := h.verificationService.ResendVerification(context.Background(), email); err != nil {
+			log.Printf("Failed to send verification email: %v", err)
+		}
+	}(req.Email)
+
+	// Answer the same way whether or not the email has an account
+	c.JSON(http.StatusOK, gin.H{"message": "if the email belongs to an unverified account, a new verification link was sent"})
+}
+
+// ForgotPassword handles sending a password reset email
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	// Parse request
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Send the email in the background so the response time does not reveal whether the account exists
+	go func(email string) {
+		if err := h.passwordResetService.RequestReset(context.Background(), email); err != nil {
+			log.Printf("Failed to send password reset email: %v", err)
+		}
+	}(req.Email)
+
+	c.JSON(http.StatusOK, gin.H{"message": "if the email belongs to an account, a password reset link was sent"})
+}
+
+// ResetPassword handles setting a new password with a password reset token
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	// Parse request
+	var req struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"newPassword" binding:"required,min=6"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Reset password
+	if err := h.passwordResetService.ResetPassword(c.Request.Context(), req.Token, req.NewPassword); err != nil {
+		if errors.Is(err, services.ErrInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password reset successfully"})
+}
+
+// Logout handles revoking the current session
+func (h *AuthHandler) Logout(c *gin.Context) {
+	// Get session ID from context
+	sessionID, exists := c.Get("sessionID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
 
-	// Return new token
-	c.JSON(http.StatusOK, gin.H{"token": newToken})
+	// Revoke session
+	if err := h.sessionService.RevokeSession(c.Request.Context(), sessionID.(uuid.UUID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out successfully"})
+}
+
+// LogoutAll handles revoking every session of the user
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Revoke sessions
+	if err := h.sessionService.RevokeAllSessions(c.Request.Context(), userID.(uuid.UUID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out of all sessions successfully"})
+}
+
+// startSession writes the response for a user who signed in, users with two-factor
+// authentication enabled get a challenge to complete with a code instead of a session
+func startSession(c *gin.Context, sessionService *services.SessionService, twoFactorService *services.TwoFactorService, user *models.User) {
+	if user.TOTPEnabled {
+		challenge, err := twoFactorService.CreateChallenge(c.Request.Context(), user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"twoFactorRequired": true,
+			"challengeToken":    challenge,
+		})
+		return
+	}
+
+	// Start session
+	tokens, err := sessionService.CreateSession(user, clientInfo(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Return tokens
+	c.JSON(http.StatusOK, tokenResponse(tokens))
+}
+
+// clientInfo returns the client a request comes from
+func clientInfo(c *gin.Context) services.ClientInfo {
+	return services.ClientInfo{
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
+}
+
+// tooManyLoginAttempts writes the response for a throttled login, it does not tell whether the account exists
+func tooManyLoginAttempts(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", retryAfterSeconds(wait))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many login attempts, please try again later"})
+}
+
+// retryAfterSeconds formats a wait as the value of a Retry-After header
+func retryAfterSeconds(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
+
+// tokenResponse converts a token pair to the response format
+func tokenResponse(tokens *services.TokenPair) gin.H {
+	return gin.H{
+		"token":        tokens.AccessToken,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    int(tokens.ExpiresIn.Seconds()),
+	}
 }
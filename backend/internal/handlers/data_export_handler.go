@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/services"
+)
+
+// DataExportHandler handles users exporting their personal data
+type DataExportHandler struct {
+	dataExportService *services.DataExportService
+}
+
+// NewDataExportHandler creates a new data export handler
+func NewDataExportHandler(dataExportService *services.DataExportService) *DataExportHandler {
+	return &DataExportHandler{
+		dataExportService: dataExportService,
+	}
+}
+
+// dataExportResponse builds the response body describing a data export
+func dataExportResponse(export *models.DataExport) gin.H {
+	return gin.H{
+		"id":          export.ID,
+		"status":      export.Status,
+		"sizeBytes":   export.SizeBytes,
+		"createdAt":   export.CreatedAt,
+		"completedAt": export.CompletedAt,
+		"expiresAt":   export.ExpiresAt,
+	}
+}
+
+// RequestExport handles starting an export of the user's data
+func (h *DataExportHandler) RequestExport(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Queue export
+	export, err := h.dataExportService.RequestExport(userID.(uuid.UUID))
+	if err != nil {
+		if errors.Is(err, services.ErrExportInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dataExportResponse(export))
+}
+
+// GetExport handles getting the status of an export of the user's data
+func (h *DataExportHandler) GetExport(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Parse export ID
+	exportID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid export ID"})
+		return
+	}
+
+	// Get export
+	export, err := h.dataExportService.GetExport(userID.(uuid.UUID), exportID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dataExportResponse(export))
+}
+
+// DownloadExport handles downloading an export with the token from its emailed link.
+// The token comes in the request body rather than the URL so it stays out of access logs.
+func (h *DataExportHandler) DownloadExport(c *gin.Context) {
+	// Parse request, a JSON body or a submitted form
+	var req struct {
+		Token string `json:"token" form:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get export
+	export, err := h.dataExportService.GetDownload(req.Token)
+	if err != nil {
+		if errors.Is(err, services.ErrExportUnavailable) {
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Large archives outlive the server write timeout
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Failed to clear write deadline for data export download: %v", err)
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.FileAttachment(export.FilePath, "papo-reto-"+export.CreatedAt.Format("2006-01-02")+".zip")
+}
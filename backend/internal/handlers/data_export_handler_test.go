@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/auth"
+	"github.com/ralfferreira/papo-reto/internal/config"
+	"github.com/ralfferreira/papo-reto/internal/mail"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+	"github.com/ralfferreira/papo-reto/internal/services"
+	"github.com/ralfferreira/papo-reto/internal/testdb"
+)
+
+func TestDownloadExport(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "archive.zip")
+	if err := os.WriteFile(archive, []byte("zip"), 0o600); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		filePath string
+		instance string
+		want     int
+	}{
+		{"archive on this instance", archive, "api-1", http.StatusOK},
+		{"archive deleted", filepath.Join(dir, "deleted.zip"), "api-1", http.StatusGone},
+		{"archive on another instance", filepath.Join(dir, "other.zip"), "api-2", http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testdb.New(t, &models.DataExport{})
+
+			token, hash, err := auth.GenerateOpaqueToken()
+			if err != nil {
+				t.Fatalf("failed to generate token: %v", err)
+			}
+			expiresAt := time.Now().Add(time.Hour)
+			testdb.Create(t, db, &models.DataExport{
+				UserID:    uuid.New(),
+				Status:    models.DataExportStatusCompleted,
+				FilePath:  tt.filePath,
+				Instance:  tt.instance,
+				TokenHash: hash,
+				ExpiresAt: &expiresAt,
+			})
+
+			cfg := &config.Config{App: config.AppConfig{ExportDir: dir, InstanceID: "api-1"}}
+			service := services.NewDataExportService(repository.NewDataExportRepository(db), nil, nil, nil, nil, nil, mail.NewMemoryMailer(), cfg)
+
+			router := gin.New()
+			router.POST("/exports/download", NewDataExportHandler(service).DownloadExport)
+
+			req := httptest.NewRequest(http.MethodPost, "/exports/download", strings.NewReader(`{"token": "`+token+`"}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d (body: %s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
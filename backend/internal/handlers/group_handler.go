@@ -2,25 +2,47 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/moderation"
+	"github.com/ralfferreira/papo-reto/internal/ratelimit"
+	"github.com/ralfferreira/papo-reto/internal/realtime"
 	"github.com/ralfferreira/papo-reto/internal/services"
 )
 
 // GroupHandler handles group requests
 type GroupHandler struct {
-	groupService *services.MessageGroupService
+	groupService   *services.MessageGroupService
+	landingService *services.GroupLandingService
+	policy         *services.AccessPolicy
+	hub            *realtime.Hub
 }
 
 // NewGroupHandler creates a new group handler
-func NewGroupHandler(groupService *services.MessageGroupService) *GroupHandler {
+func NewGroupHandler(groupService *services.MessageGroupService, landingService *services.GroupLandingService, policy *services.AccessPolicy, hub *realtime.Hub) *GroupHandler {
 	return &GroupHandler{
-		groupService: groupService,
+		groupService:   groupService,
+		landingService: landingService,
+		policy:         policy,
+		hub:            hub,
 	}
 }
 
+// validateGroupSettings checks the settings sent when creating or updating a group
+func validateGroupSettings(settings map[string]interface{}) error {
+	if err := moderation.ValidateSettings(settings); err != nil {
+		return err
+	}
+	if err := ratelimit.ValidateSettings(settings); err != nil {
+		return err
+	}
+	return services.ValidateLandingSettings(settings)
+}
+
 // GetGroups handles getting all groups for a user
 func (h *GroupHandler) GetGroups(c *gin.Context) {
 	// Get user ID from context
@@ -95,6 +117,12 @@ func (h *GroupHandler) CreateGroup(c *gin.Context) {
 		return
 	}
 
+	// Validate settings
+	if err := validateGroupSettings(req.Settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Create group
 	group, err := h.groupService.CreateGroup(userID.(uuid.UUID), req.Name, req.Description, req.IsPublic, req.Settings)
 	if err != nil {
@@ -128,7 +156,7 @@ func (h *GroupHandler) CreateGroup(c *gin.Context) {
 // GetGroup handles getting a group by ID
 func (h *GroupHandler) GetGroup(c *gin.Context) {
 	// Get user ID from context
-	userID, exists := c.Get("userID")
+	_, exists := c.Get("userID")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
@@ -141,15 +169,8 @@ func (h *GroupHandler) GetGroup(c *gin.Context) {
 		return
 	}
 
-	// Check if user is the owner
-	isOwner, err := h.groupService.IsUserOwner(groupID, userID.(uuid.UUID))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	if !isOwner {
-		c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to access this group"})
+	// Check if user can access this group
+	if _, ok := authorizeGroup(c, h.policy, groupID, services.ActionViewGroup); !ok {
 		return
 	}
 
@@ -186,7 +207,7 @@ func (h *GroupHandler) GetGroup(c *gin.Context) {
 // UpdateGroup handles updating a group
 func (h *GroupHandler) UpdateGroup(c *gin.Context) {
 	// Get user ID from context
-	userID, exists := c.Get("userID")
+	_, exists := c.Get("userID")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
@@ -199,15 +220,9 @@ func (h *GroupHandler) UpdateGroup(c *gin.Context) {
 		return
 	}
 
-	// Check if user is the owner
-	isOwner, err := h.groupService.IsUserOwner(groupID, userID.(uuid.UUID))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	if !isOwner {
-		c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to update this group"})
+	// Check if user can update this group
+	group, ok := authorizeGroup(c, h.policy, groupID, services.ActionUpdateGroup)
+	if !ok {
 		return
 	}
 
@@ -224,19 +239,28 @@ func (h *GroupHandler) UpdateGroup(c *gin.Context) {
 		return
 	}
 
+	// Validate settings
+	if err := validateGroupSettings(req.Settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Update group
 	if err := h.groupService.UpdateGroup(groupID, req.Name, req.Description, req.IsPublic, req.Settings); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// The public page shows the new name, description and settings
+	h.landingService.Invalidate(c.Request.Context(), group)
+
 	c.JSON(http.StatusOK, gin.H{"message": "group updated successfully"})
 }
 
 // ArchiveGroup handles archiving a group
 func (h *GroupHandler) ArchiveGroup(c *gin.Context) {
 	// Get user ID from context
-	userID, exists := c.Get("userID")
+	_, exists := c.Get("userID")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
@@ -249,15 +273,9 @@ func (h *GroupHandler) ArchiveGroup(c *gin.Context) {
 		return
 	}
 
-	// Check if user is the owner
-	isOwner, err := h.groupService.IsUserOwner(groupID, userID.(uuid.UUID))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	if !isOwner {
-		c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to archive this group"})
+	// Check if user can archive this group
+	group, ok := authorizeGroup(c, h.policy, groupID, services.ActionArchiveGroup)
+	if !ok {
 		return
 	}
 
@@ -267,13 +285,21 @@ func (h *GroupHandler) ArchiveGroup(c *gin.Context) {
 		return
 	}
 
+	// The public page stops accepting messages
+	h.landingService.Invalidate(c.Request.Context(), group)
+
+	// Notify subscribers of the group
+	if err := h.hub.Publish(c.Request.Context(), realtime.EventGroupArchived, groupID, gin.H{"id": groupID}); err != nil {
+		log.Printf("Failed to publish %s event: %v", realtime.EventGroupArchived, err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "group archived successfully"})
 }
 
 // UnarchiveGroup handles unarchiving a group
 func (h *GroupHandler) UnarchiveGroup(c *gin.Context) {
 	// Get user ID from context
-	userID, exists := c.Get("userID")
+	_, exists := c.Get("userID")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
@@ -286,15 +312,9 @@ func (h *GroupHandler) UnarchiveGroup(c *gin.Context) {
 		return
 	}
 
-	// Check if user is the owner
-	isOwner, err := h.groupService.IsUserOwner(groupID, userID.(uuid.UUID))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	if !isOwner {
-		c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to unarchive this group"})
+	// Check if user can archive this group
+	group, ok := authorizeGroup(c, h.policy, groupID, services.ActionArchiveGroup)
+	if !ok {
 		return
 	}
 
@@ -304,5 +324,29 @@ func (h *GroupHandler) UnarchiveGroup(c *gin.Context) {
 		return
 	}
 
+	// The public page accepts messages again
+	h.landingService.Invalidate(c.Request.Context(), group)
+
+	// Notify subscribers of the group
+	if err := h.hub.Publish(c.Request.Context(), realtime.EventGroupUnarchived, groupID, gin.H{"id": groupID}); err != nil {
+		log.Printf("Failed to publish %s event: %v", realtime.EventGroupUnarchived, err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "group unarchived successfully"})
 }
+
+// GetPublicGroup handles getting what the public share page of a group shows
+func (h *GroupHandler) GetPublicGroup(c *gin.Context) {
+	// Get landing data, already encoded as JSON
+	data, err := h.landingService.GetLanding(c.Request.Context(), c.Param("slug"))
+	if err != nil {
+		if errors.Is(err, services.ErrGroupNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ralfferreira/papo-reto/internal/auth"
+)
+
+// GetJWKS returns a handler publishing the public keys access tokens are signed with
+func GetJWKS(jwtService *auth.JWTService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Verifiers may cache the keys, new keys must be published before they sign tokens
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, jwtService.JWKS())
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ralfferreira/papo-reto/internal/auth"
+	"github.com/ralfferreira/papo-reto/internal/config"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/services"
+)
+
+const (
+	// magicLinkCookie holds the secret binding a magic link to the browser that requested it
+	magicLinkCookie = "papo_reto_magic_link"
+
+	// magicLinkCookiePath limits the cookie to the magic link endpoints
+	magicLinkCookiePath = "/api/v1/auth/magic-link"
+
+	// magicLinkCookieMaxAge matches the lifetime of magic links, in seconds
+	magicLinkCookieMaxAge = 15 * 60
+)
+
+// MagicLinkHandler handles passwordless sign in with emailed links
+type MagicLinkHandler struct {
+	magicLinkService *services.MagicLinkService
+	sessionService   *services.SessionService
+	twoFactorService *services.TwoFactorService
+	loginGuard       *services.LoginGuard
+	secureCookies    bool
+}
+
+// NewMagicLinkHandler creates a new magic link handler
+func NewMagicLinkHandler(magicLinkService *services.MagicLinkService, sessionService *services.SessionService, twoFactorService *services.TwoFactorService, loginGuard *services.LoginGuard, cfg *config.Config) *MagicLinkHandler {
+	return &MagicLinkHandler{
+		magicLinkService: magicLinkService,
+		sessionService:   sessionService,
+		twoFactorService: twoFactorService,
+		loginGuard:       loginGuard,
+		secureCookies:    cfg.App.Environment == "production",
+	}
+}
+
+// RequestMagicLink handles emailing a sign-in link bound to the requesting browser
+func (h *MagicLinkHandler) RequestMagicLink(c *gin.Context) {
+	// Parse request
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Bind the link to this browser, the cookie is set whether or not the email has an account
+	binding, _, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(magicLinkCookie, binding, magicLinkCookieMaxAge, magicLinkCookiePath, "", h.secureCookies, true)
+
+	// Send the email in the background so the response time does not reveal whether the account exists
+	go func(email string) {
+		if err := h.magicLinkService.RequestLink(context.Background(), email, binding); err != nil {
+			log.Printf("Failed to send magic link email: %v", err)
+		}
+	}(req.Email)
+
+	c.JSON(http.StatusOK, gin.H{"message": "if the email belongs to an account, a sign-in link was sent"})
+}
+
+// ConsumeMagicLink handles signing in with the token of a magic link or the code from its email
+func (h *MagicLinkHandler) ConsumeMagicLink(c *gin.Context) {
+	// Parse request
+	var req struct {
+		Token string `json:"token" binding:"required_without=Code"`
+		Code  string `json:"code" binding:"required_without=Token"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Attempts are throttled per IP like logins
+	ctx := c.Request.Context()
+	if wait := h.loginGuard.Check(ctx, "", c.ClientIP()); wait > 0 {
+		tooManyLoginAttempts(c, wait)
+		return
+	}
+
+	binding, _ := c.Cookie(magicLinkCookie)
+
+	// Consume link, or code when the link opened in another browser
+	var user *models.User
+	var err error
+	if req.Token != "" {
+		user, err = h.magicLinkService.ConsumeLink(req.Token, binding)
+	} else {
+		user, err = h.magicLinkService.ConsumeCode(req.Code, binding)
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrMagicLinkOtherBrowser):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "codeRequired": true})
+		case errors.Is(err, services.ErrInvalidMagicLink):
+			if wait := h.loginGuard.RecordFailure(ctx, "", c.ClientIP()); wait > 0 {
+				c.Header("Retry-After", retryAfterSeconds(wait))
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	// The binding is single use like the link
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(magicLinkCookie, "", -1, magicLinkCookiePath, "", h.secureCookies, true)
+
+	startSession(c, h.sessionService, h.twoFactorService, user)
+}
@@ -1,18 +1,72 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/auth"
 	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/moderation"
+	"github.com/ralfferreira/papo-reto/internal/realtime"
 	"github.com/ralfferreira/papo-reto/internal/repository"
+	"github.com/ralfferreira/papo-reto/internal/services"
 )
 
+// messageResponse converts a message to its response format
+func messageResponse(message *models.Message) gin.H {
+	return gin.H{
+		"id":         message.ID,
+		"groupId":    message.GroupID,
+		"content":    message.Content,
+		"icebreaker": message.Icebreaker,
+		"isRead":     message.IsRead,
+		"isFavorite": message.IsFavorite,
+		"isRevealed": message.IsRevealed,
+		"senderID":   message.SenderID,
+		"senderName": message.SenderName,
+		"createdAt":  message.CreatedAt,
+
+		"moderationStatus": message.ModerationStatus,
+		"moderationReason": message.ModerationReason,
+
+		"answer":         message.Answer,
+		"answeredAt":     message.AnsweredAt,
+		"isAnswerPublic": message.IsAnswerPublic,
+		"threadClosedAt": message.ThreadClosedAt,
+	}
+}
+
+// publishMessageEvent notifies the subscribers of a message's group. Every viewer of the
+// group subscribes, so nothing is published about messages held by moderation.
+func publishMessageEvent(c *gin.Context, hub *realtime.Hub, eventType string, message *models.Message, data interface{}) {
+	if message.ModerationStatus != models.ModerationStatusApproved {
+		return
+	}
+
+	if err := hub.Publish(c.Request.Context(), eventType, message.GroupID, data); err != nil {
+		log.Printf("Failed to publish %s event: %v", eventType, err)
+	}
+}
+
+// messageStatusFilters maps the status query parameter to the moderation statuses it lists
+var messageStatusFilters = map[string][]string{
+	models.ModerationStatusApproved: {models.ModerationStatusApproved},
+	models.ModerationStatusPending:  {models.ModerationStatusPending},
+	models.ModerationStatusRejected: {models.ModerationStatusRejected},
+	"all": {
+		models.ModerationStatusApproved,
+		models.ModerationStatusPending,
+		models.ModerationStatusRejected,
+	},
+}
+
 // GetMessages returns a handler for getting messages in a group
-func GetMessages(messageRepo *repository.MessageRepository) gin.HandlerFunc {
+func GetMessages(messageRepo *repository.MessageRepository, policy *services.AccessPolicy) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get user ID from context
 		_, exists := c.Get("userID")
@@ -40,8 +94,26 @@ func GetMessages(messageRepo *repository.MessageRepository) gin.HandlerFunc {
 			pageSize = 20
 		}
 
+		// Only the inbox is listed unless another moderation status is requested
+		status := c.DefaultQuery("status", models.ModerationStatusApproved)
+		statuses, ok := messageStatusFilters[status]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status filter"})
+			return
+		}
+
+		// Messages held by moderation are only visible to those who moderate them
+		action := services.ActionViewMessages
+		if status != models.ModerationStatusApproved {
+			action = services.ActionModerateMessages
+		}
+
+		if _, ok := authorizeGroup(c, policy, groupID, action); !ok {
+			return
+		}
+
 		// Get messages
-		messages, err := messageRepo.GetByGroupIDPaginated(groupID, page, pageSize)
+		messages, err := messageRepo.GetByGroupIDPaginated(groupID, statuses, page, pageSize)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -49,16 +121,8 @@ func GetMessages(messageRepo *repository.MessageRepository) gin.HandlerFunc {
 
 		// Convert to response format
 		var response []gin.H
-		for _, message := range messages {
-			response = append(response, gin.H{
-				"id":         message.ID,
-				"content":    message.Content,
-				"isRead":     message.IsRead,
-				"isFavorite": message.IsFavorite,
-				"isRevealed": message.IsRevealed,
-				"senderID":   message.SenderID,
-				"createdAt":  message.CreatedAt,
-			})
+		for i := range messages {
+			response = append(response, messageResponse(&messages[i]))
 		}
 
 		c.JSON(http.StatusOK, gin.H{"messages": response})
@@ -66,7 +130,7 @@ func GetMessages(messageRepo *repository.MessageRepository) gin.HandlerFunc {
 }
 
 // UpdateMessage returns a handler for updating a message
-func UpdateMessage(messageRepo *repository.MessageRepository) gin.HandlerFunc {
+func UpdateMessage(messageRepo *repository.MessageRepository, policy *services.AccessPolicy, hub *realtime.Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get user ID from context
 		_, exists := c.Get("userID")
@@ -93,34 +157,41 @@ func UpdateMessage(messageRepo *repository.MessageRepository) gin.HandlerFunc {
 			return
 		}
 
-		// Get message
-		message, err := messageRepo.GetByID(messageID)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		// Get message, checking if user can update messages of its group
+		message, ok := authorizeMessage(c, policy, messageID, services.ActionUpdateMessages)
+		if !ok {
 			return
 		}
 
-		// Update message
+		// Update message, only the changed columns are saved
+		columns := make(map[string]interface{})
 		if req.IsRead != nil && *req.IsRead != message.IsRead {
 			message.IsRead = *req.IsRead
+			columns["is_read"] = message.IsRead
 		}
 
 		if req.IsFavorite != nil && *req.IsFavorite != message.IsFavorite {
 			message.IsFavorite = *req.IsFavorite
+			columns["is_favorite"] = message.IsFavorite
 		}
 
 		// Save message
-		if err := messageRepo.Update(message); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+		if len(columns) > 0 {
+			if err := messageRepo.UpdateColumns(message.ID, columns); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
 		}
 
+		// Notify subscribers of the group
+		publishMessageEvent(c, hub, realtime.EventMessageUpdated, message, messageResponse(message))
+
 		c.JSON(http.StatusOK, gin.H{"message": "message updated successfully"})
 	}
 }
 
 // DeleteMessage returns a handler for deleting a message
-func DeleteMessage(messageRepo *repository.MessageRepository) gin.HandlerFunc {
+func DeleteMessage(messageRepo *repository.MessageRepository, policy *services.AccessPolicy, hub *realtime.Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get user ID from context
 		_, exists := c.Get("userID")
@@ -136,18 +207,29 @@ func DeleteMessage(messageRepo *repository.MessageRepository) gin.HandlerFunc {
 			return
 		}
 
+		// Get message, checking if user can delete messages of its group
+		message, ok := authorizeMessage(c, policy, messageID, services.ActionDeleteMessages)
+		if !ok {
+			return
+		}
+
 		// Delete message
 		if err := messageRepo.Delete(messageID); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
+		// Notify subscribers of the group
+		if err := hub.Publish(c.Request.Context(), realtime.EventMessageDeleted, message.GroupID, gin.H{"id": message.ID}); err != nil {
+			log.Printf("Failed to publish %s event: %v", realtime.EventMessageDeleted, err)
+		}
+
 		c.JSON(http.StatusOK, gin.H{"message": "message deleted successfully"})
 	}
 }
 
 // SendAnonymousMessage returns a handler for sending an anonymous message
-func SendAnonymousMessage(messageRepo *repository.MessageRepository, groupRepo *repository.MessageGroupRepository, userRepo *repository.UserRepository) gin.HandlerFunc {
+func SendAnonymousMessage(messageRepo *repository.MessageRepository, groupRepo *repository.MessageGroupRepository, userRepo *repository.UserRepository, userService *services.UserService, hub *realtime.Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get slug from URL
 		slug := c.Param("slug")
@@ -171,9 +253,9 @@ func SendAnonymousMessage(messageRepo *repository.MessageRepository, groupRepo *
 
 		// Parse request
 		var req struct {
-			Content    string  `json:"content" binding:"required"`
-			SenderID   *string `json:"senderId"`
-			RevealName bool    `json:"revealName"`
+			Content    string `json:"content" binding:"required"`
+			Icebreaker string `json:"icebreaker"`
+			RevealName bool   `json:"revealName"`
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -181,27 +263,103 @@ func SendAnonymousMessage(messageRepo *repository.MessageRepository, groupRepo *
 			return
 		}
 
+		// The icebreaker being answered must be one the group asks
+		if req.Icebreaker != "" && !group.HasIcebreaker(req.Icebreaker) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown icebreaker"})
+			return
+		}
+
 		// Create message
 		message := &models.Message{
-			GroupID:   group.ID,
-			Content:   req.Content,
-			SenderIP:  c.ClientIP(),
-			IsRead:    false,
-			CreatedAt: time.Now(),
+			GroupID:          group.ID,
+			Content:          req.Content,
+			Icebreaker:       req.Icebreaker,
+			SenderIP:         c.ClientIP(),
+			IsRead:           false,
+			ModerationStatus: models.ModerationStatusApproved,
+			CreatedAt:        time.Now(),
+		}
+
+		// Run content moderation
+		pipeline, err := moderation.ForGroup(group)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		result := pipeline.Run(req.Content)
+		switch result.Action {
+		case moderation.ActionReject:
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "message contains content that is not allowed in this group"})
+			return
+		case moderation.ActionMask:
+			message.Content = result.Content
+		case moderation.ActionQuarantine:
+			message.ModerationStatus = models.ModerationStatusPending
+			message.ModerationReason = result.Summary(500)
+		}
+
+		// Hold every message for review when the group asks for it
+		if group.IsReviewBeforeInbox() {
+			message.ModerationStatus = models.ModerationStatusPending
+		}
+
+		// Signed in senders are recorded privately, so only they can reveal themselves later
+		senderID, signedIn := c.Get("userID")
+		if signedIn {
+			senderUserID := senderID.(uuid.UUID)
+			message.SenderUserID = &senderUserID
 		}
 
-		// Handle identity revelation if requested
-		if req.RevealName && req.SenderID != nil {
-			message.IsRevealed = true
-			message.SenderID = req.SenderID
+		// Only signed in senders can reveal who they are
+		if req.RevealName {
+			if !signedIn {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "sign in to reveal your identity"})
+				return
+			}
+
+			sender, err := userRepo.GetByID(senderID.(uuid.UUID))
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "sign in to reveal your identity"})
+				return
+			}
+			message.RevealIdentity(sender)
+		}
+
+		// The receipt token lets the sender follow the thread, only its hash is stored
+		receiptToken, receiptTokenHash, err := auth.GenerateOpaqueToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		message.ReceiptTokenHash = receiptTokenHash
+
+		// Count the message against the owner's monthly limit
+		if err := userService.ReserveMessage(group.UserID); err != nil {
+			if errors.Is(err, services.ErrMessageLimitReached) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "this group has reached its monthly message limit"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
 
 		// Save message
 		if err := messageRepo.Create(message); err != nil {
+			if releaseErr := userService.ReleaseMessage(group.UserID); releaseErr != nil {
+				log.Printf("Failed to release monthly message quota: %v", releaseErr)
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
+		// Notify the group owner in real time, pending messages stay out of the inbox
+		if !message.IsPending() {
+			if err := hub.Publish(c.Request.Context(), realtime.EventMessageCreated, group.ID, messageResponse(message)); err != nil {
+				log.Printf("Failed to publish %s event: %v", realtime.EventMessageCreated, err)
+			}
+		}
+
 		// Increment user's message count
 		if err := userRepo.IncrementMessageCount(group.UserID); err != nil {
 			// Log error but don't fail the request
@@ -209,6 +367,9 @@ func SendAnonymousMessage(messageRepo *repository.MessageRepository, groupRepo *
 			// log.Printf("Failed to increment message count: %v", err)
 		}
 
-		c.JSON(http.StatusCreated, gin.H{"message": "message sent successfully"})
+		c.JSON(http.StatusCreated, gin.H{
+			"message":      "message sent successfully",
+			"receiptToken": receiptToken,
+		})
 	}
 }
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/realtime"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+	"github.com/ralfferreira/papo-reto/internal/services"
+)
+
+// moderationDecisions maps a moderation decision to the status it sets
+var moderationDecisions = map[string]string{
+	"approve": models.ModerationStatusApproved,
+	"reject":  models.ModerationStatusRejected,
+}
+
+// GetModerationQueue returns a handler for listing the pending messages of a group
+func GetModerationQueue(messageRepo *repository.MessageRepository, policy *services.AccessPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Get user ID from context
+		_, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		// Get group ID from URL
+		groupID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid group ID"})
+			return
+		}
+
+		// Check if user can moderate the group
+		if _, ok := authorizeGroup(c, policy, groupID, services.ActionModerateMessages); !ok {
+			return
+		}
+
+		// Get pagination parameters
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+
+		// Validate pagination parameters
+		if page < 1 {
+			page = 1
+		}
+		if pageSize < 1 || pageSize > 100 {
+			pageSize = 20
+		}
+
+		// Get pending messages
+		messages, err := messageRepo.GetByGroupIDPaginated(groupID, []string{models.ModerationStatusPending}, page, pageSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		total, err := messageRepo.CountByGroupIDAndStatus(groupID, models.ModerationStatusPending)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Convert to response format
+		var response []gin.H
+		for i := range messages {
+			response = append(response, messageResponse(&messages[i]))
+		}
+
+		c.JSON(http.StatusOK, gin.H{"messages": response, "total": total})
+	}
+}
+
+// ApproveMessage returns a handler for releasing a pending message to the inbox
+func ApproveMessage(messageRepo *repository.MessageRepository, policy *services.AccessPolicy, hub *realtime.Hub) gin.HandlerFunc {
+	return moderateMessage(messageRepo, policy, hub, "approve")
+}
+
+// RejectMessage returns a handler for keeping a message out of the inbox
+func RejectMessage(messageRepo *repository.MessageRepository, policy *services.AccessPolicy, hub *realtime.Hub) gin.HandlerFunc {
+	return moderateMessage(messageRepo, policy, hub, "reject")
+}
+
+// moderateMessage returns a handler applying a moderation decision to a single message
+func moderateMessage(messageRepo *repository.MessageRepository, policy *services.AccessPolicy, hub *realtime.Hub, decision string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Get user ID from context
+		_, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		// Get message ID from URL
+		messageID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+			return
+		}
+
+		// Parse request, the body is optional
+		var req struct {
+			Reason string `json:"reason" binding:"max=500"`
+		}
+
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		// Get message, checking if user can moderate its group
+		message, ok := authorizeMessage(c, policy, messageID, services.ActionModerateMessages)
+		if !ok {
+			return
+		}
+
+		updated, err := applyModerationDecision(c, messageRepo, hub, message.GroupID, []models.Message{*message}, decision, req.Reason)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "message moderated successfully", "updated": updated})
+	}
+}
+
+// DecideMessages returns a handler for approving or rejecting several messages of a group at once
+func DecideMessages(messageRepo *repository.MessageRepository, policy *services.AccessPolicy, hub *realtime.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Get user ID from context
+		_, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		// Get group ID from URL
+		groupID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid group ID"})
+			return
+		}
+
+		// Parse request
+		var req struct {
+			MessageIDs []uuid.UUID `json:"messageIds" binding:"required,min=1,max=100"`
+			Decision   string      `json:"decision" binding:"required,oneof=approve reject"`
+			Reason     string      `json:"reason" binding:"max=500"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Check if user can moderate the group
+		if _, ok := authorizeGroup(c, policy, groupID, services.ActionModerateMessages); !ok {
+			return
+		}
+
+		// Get messages, IDs from other groups are ignored
+		messages, err := messageRepo.GetByIDs(groupID, req.MessageIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		updated, err := applyModerationDecision(c, messageRepo, hub, groupID, messages, req.Decision, req.Reason)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "messages moderated successfully", "updated": updated})
+	}
+}
+
+// applyModerationDecision updates the moderation status of messages and announces the ones
+// entering or leaving the inbox
+func applyModerationDecision(c *gin.Context, messageRepo *repository.MessageRepository, hub *realtime.Hub, groupID uuid.UUID, messages []models.Message, decision, reason string) (int64, error) {
+	status := moderationDecisions[decision]
+
+	ids := make([]uuid.UUID, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	// Approved messages keep the reason they were held for
+	if status == models.ModerationStatusApproved {
+		reason = ""
+	}
+
+	updated, err := messageRepo.UpdateModerationStatus(groupID, ids, status, reason)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range messages {
+		message := &messages[i]
+		wasApproved := message.ModerationStatus == models.ModerationStatusApproved
+
+		switch {
+		case status == models.ModerationStatusApproved && !wasApproved:
+			// Approved messages reach the inbox now, notify the owner as if they had just arrived
+			message.Approve()
+			if err := hub.Publish(c.Request.Context(), realtime.EventMessageCreated, groupID, messageResponse(message)); err != nil {
+				log.Printf("Failed to publish %s event: %v", realtime.EventMessageCreated, err)
+			}
+		case status != models.ModerationStatusApproved && wasApproved:
+			// Messages taken out of the inbox disappear for the viewers who already got them
+			if err := hub.Publish(c.Request.Context(), realtime.EventMessageDeleted, groupID, gin.H{"id": message.ID}); err != nil {
+				log.Printf("Failed to publish %s event: %v", realtime.EventMessageDeleted, err)
+			}
+		}
+	}
+
+	return updated, nil
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/config"
+	"github.com/ralfferreira/papo-reto/internal/services"
+)
+
+const (
+	// oidcCookie holds the hash of the state binding a login with a provider to the browser that started it
+	oidcCookie = "papo_reto_oidc"
+
+	// oidcCookiePath limits the cookie to the OpenID Connect endpoints
+	oidcCookiePath = "/api/v1/auth/oidc"
+
+	// oidcCookieMaxAge matches the lifetime of login states, in seconds
+	oidcCookieMaxAge = 10 * 60
+)
+
+// OIDCHandler handles sign in with external OpenID Connect providers
+type OIDCHandler struct {
+	oidcService      *services.OIDCService
+	sessionService   *services.SessionService
+	twoFactorService *services.TwoFactorService
+	secureCookies    bool
+}
+
+// NewOIDCHandler creates a new OpenID Connect handler
+func NewOIDCHandler(oidcService *services.OIDCService, sessionService *services.SessionService, twoFactorService *services.TwoFactorService, cfg *config.Config) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService:      oidcService,
+		sessionService:   sessionService,
+		twoFactorService: twoFactorService,
+		secureCookies:    cfg.App.Environment == "production",
+	}
+}
+
+// GetProviders handles listing the providers users can sign in with
+func (h *OIDCHandler) GetProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.oidcService.Providers()})
+}
+
+// Authorize handles starting a login with a provider, the client sends the user to the returned URL
+func (h *OIDCHandler) Authorize(c *gin.Context) {
+	// Get authorization URL
+	authorizationURL, binding, err := h.oidcService.AuthorizationURL(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		writeOIDCError(c, err)
+		return
+	}
+
+	// Bind the login to this browser, the callback is refused without the cookie
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcCookie, binding, oidcCookieMaxAge, oidcCookiePath, "", h.secureCookies, true)
+
+	c.JSON(http.StatusOK, gin.H{"authorizationUrl": authorizationURL})
+}
+
+// Callback handles completing a login with the code and state the provider redirected the user back with
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	// Parse request
+	var req struct {
+		Code  string `json:"code" binding:"required"`
+		State string `json:"state" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Authenticate user
+	binding, _ := c.Cookie(oidcCookie)
+	user, err := h.oidcService.Authenticate(c.Request.Context(), c.Param("provider"), req.Code, req.State, binding)
+	if err != nil {
+		writeOIDCError(c, err)
+		return
+	}
+
+	// The binding is single use like the state
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcCookie, "", -1, oidcCookiePath, "", h.secureCookies, true)
+
+	startSession(c, h.sessionService, h.twoFactorService, user)
+}
+
+// GetIdentities handles listing the providers linked to the user's account
+func (h *OIDCHandler) GetIdentities(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Get identities
+	identities, err := h.oidcService.GetIdentities(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Convert to response format
+	response := make([]gin.H, 0, len(identities))
+	for _, identity := range identities {
+		response = append(response, gin.H{
+			"provider":  identity.Provider,
+			"email":     identity.Email,
+			"createdAt": identity.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"identities": response})
+}
+
+// writeOIDCError writes the response for an OpenID Connect service error
+func writeOIDCError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrUnknownProvider):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidLoginState), errors.Is(err, services.ErrExternalLoginFailed):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrEmailNotVerified), errors.Is(err, services.ErrAccountNotLinkable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
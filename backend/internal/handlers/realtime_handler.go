@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/ralfferreira/papo-reto/internal/auth"
+	"github.com/ralfferreira/papo-reto/internal/config"
+	"github.com/ralfferreira/papo-reto/internal/realtime"
+	"github.com/ralfferreira/papo-reto/internal/services"
+)
+
+const (
+	// Time allowed to write a message to the peer
+	wsWriteWait = 10 * time.Second
+
+	// Time allowed to read the next pong message from the peer
+	wsPongWait = 60 * time.Second
+
+	// Send pings to the peer with this period, must be less than wsPongWait
+	wsPingPeriod = (wsPongWait * 9) / 10
+
+	// Send keep-alive comments on event streams with this period so proxies keep them open
+	sseKeepAlivePeriod = 20 * time.Second
+)
+
+// RealtimeHandler handles realtime inbox connections
+type RealtimeHandler struct {
+	hub      *realtime.Hub
+	policy   *services.AccessPolicy
+	tickets  *auth.TicketStore
+	upgrader websocket.Upgrader
+}
+
+// NewRealtimeHandler creates a new realtime handler
+func NewRealtimeHandler(hub *realtime.Hub, policy *services.AccessPolicy, tickets *auth.TicketStore, cfg *config.Config) *RealtimeHandler {
+	return &RealtimeHandler{
+		hub:     hub,
+		policy:  policy,
+		tickets: tickets,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			// Browsers send their origin on every socket, only the frontend's are accepted.
+			// Clients outside a browser send none.
+			CheckOrigin: func(r *http.Request) bool {
+				origin := r.Header.Get("Origin")
+				return origin == "" || isOrigin(origin, cfg.App.FrontendURL)
+			},
+		},
+	}
+}
+
+// CreateTicket issues a single-use ticket to open a stream as the authenticated user.
+// Browsers cannot set headers on stream requests, so the ticket goes in the URL in place
+// of the access token.
+func (h *RealtimeHandler) CreateTicket(c *gin.Context) {
+	// Get user from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	claims := &auth.JWTClaims{
+		UserID:    userID.(uuid.UUID),
+		Email:     c.GetString("email"),
+		SessionID: c.MustGet("sessionID").(uuid.UUID),
+	}
+
+	ticket, err := h.tickets.Create(c.Request.Context(), claims)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create stream ticket"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"ticket":    ticket,
+		"expiresIn": int(h.tickets.TTL().Seconds()),
+	})
+}
+
+// ServeWS handles WebSocket connections streaming the events of the user's groups
+func (h *RealtimeHandler) ServeWS(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Resolve the groups to subscribe to
+	groupIDs, err := h.resolveGroups(userID.(uuid.UUID), c.Query("groups"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Subscribe before upgrading so a closing hub can still answer with a plain HTTP error
+	sub, err := h.hub.Subscribe(groupIDs)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	defer sub.Close()
+
+	// Upgrade connection
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already written an HTTP error response
+		return
+	}
+	defer conn.Close()
+
+	// Read from the socket to process control frames and detect disconnects
+	disconnected := make(chan struct{})
+	go func() {
+		defer close(disconnected)
+
+		conn.SetReadLimit(512)
+		_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		})
+
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event := <-sub.Events():
+			_ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			_ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+
+		case <-sub.Done():
+			// Server is shutting down, tell the client to reconnect elsewhere
+			closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+			if err := conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(wsWriteWait)); err != nil {
+				log.Printf("Failed to close WebSocket connection: %v", err)
+				return
+			}
+
+			// Give the client a chance to acknowledge the close frame
+			select {
+			case <-disconnected:
+			case <-time.After(wsWriteWait):
+			}
+			return
+
+		case <-disconnected:
+			return
+		}
+	}
+}
+
+// ServeSSE handles Server-Sent Events streams of a group's inbox events
+func (h *RealtimeHandler) ServeSSE(c *gin.Context) {
+	// Get user ID from context
+	_, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Get group ID from URL
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid group ID"})
+		return
+	}
+
+	// Check if user can view the messages of the group
+	if _, ok := authorizeGroup(c, h.policy, groupID, services.ActionViewMessages); !ok {
+		return
+	}
+
+	// EventSource sends the Last-Event-ID header when reconnecting, the query
+	// parameter covers clients that open a fresh connection to resume
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+
+	// Subscribe before replaying so no event is lost in between
+	sub, err := h.hub.Subscribe([]uuid.UUID{groupID})
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	defer sub.Close()
+
+	var replay []realtime.Event
+	if lastEventID != "" {
+		replay, err = h.hub.Replay(c.Request.Context(), groupID, lastEventID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// The stream outlives the server write timeout
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Failed to clear write deadline for event stream: %v", err)
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// Send the events the client missed
+	for _, event := range replay {
+		writeSSEvent(c, event)
+		lastEventID = event.ID
+	}
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(sseKeepAlivePeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event := <-sub.Events():
+			// Skip live events that were already sent as part of the replay
+			if lastEventID != "" && !realtime.IsEventAfter(event.ID, lastEventID) {
+				continue
+			}
+			writeSSEvent(c, event)
+			lastEventID = event.ID
+			c.Writer.Flush()
+
+		case <-ticker.C:
+			if _, err := c.Writer.WriteString(": keep-alive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+
+		case <-sub.Done():
+			// Server is shutting down, the client reconnects with Last-Event-ID
+			return
+
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// writeSSEvent writes an event to an event stream
+func writeSSEvent(c *gin.Context, event realtime.Event) {
+	c.Render(-1, sse.Event{
+		Id:    event.ID,
+		Event: event.Type,
+		Data:  event,
+	})
+}
+
+// resolveGroups returns the IDs of the groups the user can follow, optionally narrowed by a comma separated list
+func (h *RealtimeHandler) resolveGroups(userID uuid.UUID, filter string) ([]uuid.UUID, error) {
+	visible, err := h.policy.GroupIDs(userID, services.ActionViewMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	// Subscribe to every group when no filter is given
+	if filter == "" {
+		return visible, nil
+	}
+
+	allowed := make(map[uuid.UUID]bool, len(visible))
+	for _, groupID := range visible {
+		allowed[groupID] = true
+	}
+
+	var groupIDs []uuid.UUID
+	for _, value := range strings.Split(filter, ",") {
+		groupID, err := uuid.Parse(strings.TrimSpace(value))
+		if err != nil {
+			return nil, errors.New("invalid group ID")
+		}
+		if !allowed[groupID] {
+			return nil, errors.New("you can only subscribe to groups you have access to")
+		}
+		groupIDs = append(groupIDs, groupID)
+	}
+
+	return groupIDs, nil
+}
+
+// isOrigin checks if origin is the origin of baseURL
+func isOrigin(origin, baseURL string) bool {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(origin, u.Scheme+"://"+u.Host)
+}
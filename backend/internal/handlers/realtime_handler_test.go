@@ -0,0 +1,23 @@
+package handlers
+
+import "testing"
+
+func TestIsOrigin(t *testing.T) {
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://papo-reto.com", true},
+		{"https://PAPO-RETO.com", true},
+		{"http://papo-reto.com", false},
+		{"https://papo-reto.com:8443", false},
+		{"https://papo-reto.com.evil.com", false},
+		{"null", false},
+	}
+
+	for _, tt := range tests {
+		if got := isOrigin(tt.origin, "https://papo-reto.com/app"); got != tt.want {
+			t.Errorf("isOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/services"
+)
+
+// SessionHandler handles the sessions a user is logged in with
+type SessionHandler struct {
+	sessionService *services.SessionService
+}
+
+// NewSessionHandler creates a new session handler
+func NewSessionHandler(sessionService *services.SessionService) *SessionHandler {
+	return &SessionHandler{
+		sessionService: sessionService,
+	}
+}
+
+// GetSessions handles listing the devices the user is logged in on
+func (h *SessionHandler) GetSessions(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	currentSessionID, _ := c.Get("sessionID")
+
+	// Get sessions
+	sessions, err := h.sessionService.GetSessions(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Convert to response format
+	response := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, gin.H{
+			"id":          session.ID,
+			"deviceLabel": session.DeviceLabel,
+			"userAgent":   session.UserAgent,
+			"ipAddress":   session.IPAddress,
+			"current":     session.ID == currentSessionID,
+			"createdAt":   session.CreatedAt,
+			"lastSeenAt":  session.LastSeenAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": response})
+}
+
+// RevokeSession handles logging the user out of one of their sessions
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Get session ID from URL
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session ID"})
+		return
+	}
+
+	// Revoke session
+	if err := h.sessionService.RevokeUserSession(c.Request.Context(), userID.(uuid.UUID), sessionID); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked successfully"})
+}
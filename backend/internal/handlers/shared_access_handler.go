@@ -2,16 +2,18 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/ralfferreira/papo-reto/internal/models"
 	"github.com/ralfferreira/papo-reto/internal/repository"
+	"github.com/ralfferreira/papo-reto/internal/services"
 )
 
 // CreateSharedAccess returns a handler for creating shared access to a group
-func CreateSharedAccess(sharedAccessRepo *repository.SharedAccessRepository, groupRepo *repository.MessageGroupRepository) gin.HandlerFunc {
+func CreateSharedAccess(sharedAccessRepo *repository.SharedAccessRepository, policy *services.AccessPolicy) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get user ID from context
 		userID, exists := c.Get("userID")
@@ -27,21 +29,15 @@ func CreateSharedAccess(sharedAccessRepo *repository.SharedAccessRepository, gro
 			return
 		}
 
-		// Check if group exists and user is the owner
-		group, err := groupRepo.GetByID(groupID)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
-			return
-		}
-
-		if group.UserID != userID.(uuid.UUID) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to share this group"})
+		// Check if user can share the group
+		if _, ok := authorizeGroup(c, policy, groupID, services.ActionManageSharing); !ok {
 			return
 		}
 
 		// Parse request
 		var req struct {
 			Email     string     `json:"email" binding:"required,email"`
+			Role      string     `json:"role"`
 			ExpiresAt *time.Time `json:"expiresAt"`
 		}
 
@@ -50,6 +46,16 @@ func CreateSharedAccess(sharedAccessRepo *repository.SharedAccessRepository, gro
 			return
 		}
 
+		// Collaborators are viewers unless another role is requested
+		if req.Role == "" {
+			req.Role = models.RoleViewer
+		}
+
+		if !services.IsValidSharedRole(req.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role"})
+			return
+		}
+
 		// Generate token
 		token := uuid.New().String()
 
@@ -58,6 +64,7 @@ func CreateSharedAccess(sharedAccessRepo *repository.SharedAccessRepository, gro
 			GroupID:   groupID,
 			InvitedBy: userID.(uuid.UUID),
 			Email:     req.Email,
+			Role:      req.Role,
 			Token:     token,
 			IsActive:  true,
 			ExpiresAt: req.ExpiresAt,
@@ -76,6 +83,7 @@ func CreateSharedAccess(sharedAccessRepo *repository.SharedAccessRepository, gro
 			"id":        sharedAccess.ID,
 			"groupId":   sharedAccess.GroupID,
 			"email":     sharedAccess.Email,
+			"role":      sharedAccess.Role,
 			"token":     sharedAccess.Token,
 			"isActive":  sharedAccess.IsActive,
 			"expiresAt": sharedAccess.ExpiresAt,
@@ -85,7 +93,7 @@ func CreateSharedAccess(sharedAccessRepo *repository.SharedAccessRepository, gro
 }
 
 // GetSharedAccess returns a handler for getting shared access for a group
-func GetSharedAccess(sharedAccessRepo *repository.SharedAccessRepository) gin.HandlerFunc {
+func GetSharedAccess(sharedAccessRepo *repository.SharedAccessRepository, policy *services.AccessPolicy) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get user ID from context
 		_, exists := c.Get("userID")
@@ -101,6 +109,11 @@ func GetSharedAccess(sharedAccessRepo *repository.SharedAccessRepository) gin.Ha
 			return
 		}
 
+		// Check if user can manage the sharing of the group
+		if _, ok := authorizeGroup(c, policy, groupID, services.ActionManageSharing); !ok {
+			return
+		}
+
 		// Get shared access
 		sharedAccess, err := sharedAccessRepo.GetByGroupID(groupID)
 		if err != nil {
@@ -114,6 +127,7 @@ func GetSharedAccess(sharedAccessRepo *repository.SharedAccessRepository) gin.Ha
 			response = append(response, gin.H{
 				"id":        access.ID,
 				"email":     access.Email,
+				"role":      access.Role,
 				"token":     access.Token,
 				"isActive":  access.IsActive,
 				"expiresAt": access.ExpiresAt,
@@ -126,7 +140,7 @@ func GetSharedAccess(sharedAccessRepo *repository.SharedAccessRepository) gin.Ha
 }
 
 // RevokeSharedAccess returns a handler for revoking shared access
-func RevokeSharedAccess(sharedAccessRepo *repository.SharedAccessRepository) gin.HandlerFunc {
+func RevokeSharedAccess(sharedAccessRepo *repository.SharedAccessRepository, policy *services.AccessPolicy) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get user ID from context
 		_, exists := c.Get("userID")
@@ -136,7 +150,7 @@ func RevokeSharedAccess(sharedAccessRepo *repository.SharedAccessRepository) gin
 		}
 
 		// Get group ID and share ID from URL
-		_, err := uuid.Parse(c.Param("id"))
+		groupID, err := uuid.Parse(c.Param("id"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid group ID"})
 			return
@@ -148,8 +162,14 @@ func RevokeSharedAccess(sharedAccessRepo *repository.SharedAccessRepository) gin
 			return
 		}
 
+		// Check if the shared access belongs to the group and user can manage its sharing
+		access, ok := authorizeSharedAccess(c, policy, groupID, shareID, services.ActionManageSharing)
+		if !ok {
+			return
+		}
+
 		// Revoke shared access
-		if err := sharedAccessRepo.Revoke(shareID); err != nil {
+		if err := sharedAccessRepo.Revoke(access.ID); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -157,3 +177,125 @@ func RevokeSharedAccess(sharedAccessRepo *repository.SharedAccessRepository) gin
 		c.JSON(http.StatusOK, gin.H{"message": "shared access revoked successfully"})
 	}
 }
+
+// AcceptSharedAccess returns a handler for redeeming a shared access invitation
+func AcceptSharedAccess(sharedAccessRepo *repository.SharedAccessRepository, userRepo *repository.UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Get user ID from context
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		// Get user
+		user, err := userRepo.GetByID(userID.(uuid.UUID))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+
+		// Anyone can register with the invited email, only a verified one proves the user owns it
+		if !user.IsVerified {
+			c.JSON(http.StatusForbidden, gin.H{"error": "verify your email before accepting invitations"})
+			return
+		}
+
+		// Get invitation by token
+		sharedAccess, err := sharedAccessRepo.GetByToken(c.Param("token"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invitation not found"})
+			return
+		}
+
+		// Check if the invitation can still be redeemed
+		if !sharedAccess.IsValid() {
+			c.JSON(http.StatusGone, gin.H{"error": "this invitation has expired or was revoked"})
+			return
+		}
+
+		// Only the invited email can redeem the invitation
+		if !strings.EqualFold(sharedAccess.Email, user.Email) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "this invitation was sent to a different email"})
+			return
+		}
+
+		if !sharedAccess.IsAccepted() {
+			// Bind the invitation to the user, unless it was revoked or accepted since it was read
+			now := time.Now()
+			accepted, err := sharedAccessRepo.Accept(sharedAccess.ID, user.ID, now)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			if accepted {
+				sharedAccess.UserID = &user.ID
+				sharedAccess.AcceptedAt = &now
+			} else {
+				// Revoked, expired or accepted by another request in the meantime
+				current, err := sharedAccessRepo.GetByID(sharedAccess.ID)
+				if err != nil || !current.IsValid() || !current.IsAccepted() {
+					c.JSON(http.StatusGone, gin.H{"error": "this invitation has expired or was revoked"})
+					return
+				}
+				sharedAccess = current
+			}
+		}
+
+		// Accepting again is allowed, but only for the user it was bound to
+		if *sharedAccess.UserID != user.ID {
+			c.JSON(http.StatusConflict, gin.H{"error": "this invitation has already been accepted"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"id":         sharedAccess.ID,
+			"groupId":    sharedAccess.GroupID,
+			"role":       sharedAccess.Role,
+			"acceptedAt": sharedAccess.AcceptedAt,
+			"expiresAt":  sharedAccess.ExpiresAt,
+		})
+	}
+}
+
+// GetSharedGroups returns a handler for listing the groups shared with the user
+func GetSharedGroups(sharedAccessRepo *repository.SharedAccessRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Get user ID from context
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		// Get accepted shared access
+		sharedAccess, err := sharedAccessRepo.GetActiveByUserID(userID.(uuid.UUID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Convert to response format
+		var response []gin.H
+		for _, access := range sharedAccess {
+			response = append(response, gin.H{
+				"id":          access.Group.ID,
+				"name":        access.Group.Name,
+				"slug":        access.Group.Slug,
+				"description": access.Group.Description,
+				"isPublic":    access.Group.IsPublic,
+				"isArchived":  access.Group.IsArchived,
+				"createdAt":   access.Group.CreatedAt,
+				"sharedAccess": gin.H{
+					"id":         access.ID,
+					"role":       access.Role,
+					"acceptedAt": access.AcceptedAt,
+					"expiresAt":  access.ExpiresAt,
+				},
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{"groups": response})
+	}
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/realtime"
+	"github.com/ralfferreira/papo-reto/internal/services"
+)
+
+// ThreadHandler handles the conversations between groups and the anonymous senders of their messages
+type ThreadHandler struct {
+	threadService *services.ThreadService
+	hub           *realtime.Hub
+}
+
+// NewThreadHandler creates a new thread handler
+func NewThreadHandler(threadService *services.ThreadService, hub *realtime.Hub) *ThreadHandler {
+	return &ThreadHandler{
+		threadService: threadService,
+		hub:           hub,
+	}
+}
+
+// threadReplyResponse converts a thread reply to its response format for group members
+func threadReplyResponse(reply *models.ThreadReply) gin.H {
+	return gin.H{
+		"id":        reply.ID,
+		"messageId": reply.MessageID,
+		"author":    reply.AuthorType,
+		"authorId":  reply.AuthorID,
+		"content":   reply.Content,
+		"createdAt": reply.CreatedAt,
+	}
+}
+
+// senderReplyResponse converts a thread reply to its response format for the anonymous sender,
+// which does not tell which member replied
+func senderReplyResponse(reply *models.ThreadReply) gin.H {
+	return gin.H{
+		"id":        reply.ID,
+		"author":    reply.AuthorType,
+		"content":   reply.Content,
+		"createdAt": reply.CreatedAt,
+	}
+}
+
+// writeThreadError writes the response for a thread error
+func writeThreadError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrThreadNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrThreadClosed),
+		errors.Is(err, services.ErrThreadFull),
+		errors.Is(err, services.ErrMessageNotReady),
+		errors.Is(err, services.ErrAlreadyRevealed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrReplyNotAllowed):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNotSender):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		writeAccessError(c, err)
+	}
+}
+
+// receiptTokenRequest is the body of the sender's requests. The receipt token is a credential,
+// it comes in the body rather than the URL so it stays out of access logs.
+type receiptTokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// GetSenderThread handles the anonymous sender viewing their thread with a receipt token
+func (h *ThreadHandler) GetSenderThread(c *gin.Context) {
+	// Parse request
+	var req receiptTokenRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get thread
+	message, replies, err := h.threadService.GetSenderThread(req.Token)
+	if err != nil {
+		writeThreadError(c, err)
+		return
+	}
+
+	// Convert to response format
+	response := make([]gin.H, 0, len(replies))
+	for i := range replies {
+		response = append(response, senderReplyResponse(&replies[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": gin.H{
+			"icebreaker": message.Icebreaker,
+			"content":    message.Content,
+			"isRevealed": message.IsRevealed,
+			"answer":     message.Answer,
+			"answeredAt": message.AnsweredAt,
+			"createdAt":  message.CreatedAt,
+		},
+		"group": gin.H{
+			"name": message.Group.Name,
+			"slug": message.Group.Slug,
+		},
+		"replies": response,
+		"isOpen":  services.IsThreadOpenToSender(message),
+	})
+}
+
+// ReplyAsSender handles the anonymous sender following up on their thread with a receipt token
+func (h *ThreadHandler) ReplyAsSender(c *gin.Context) {
+	// Parse request
+	var req struct {
+		receiptTokenRequest
+		Content string `json:"content" binding:"required,max=2000"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Add reply
+	message, reply, err := h.threadService.ReplyAsSender(req.Token, req.Content)
+	if err != nil {
+		writeThreadError(c, err)
+		return
+	}
+
+	// Notify subscribers of the group
+	publishMessageEvent(c, h.hub, realtime.EventReplyCreated, message, threadReplyResponse(reply))
+
+	c.JSON(http.StatusCreated, gin.H{"reply": senderReplyResponse(reply)})
+}
+
+// RevealSender handles a signed in sender revealing their identity on a message they sent,
+// proving it with the receipt token
+func (h *ThreadHandler) RevealSender(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Parse request
+	var req receiptTokenRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Reveal identity
+	message, err := h.threadService.RevealSender(req.Token, userID.(uuid.UUID))
+	if err != nil {
+		writeThreadError(c, err)
+		return
+	}
+
+	// Notify subscribers of the group
+	publishMessageEvent(c, h.hub, realtime.EventMessageUpdated, message, messageResponse(message))
+
+	c.JSON(http.StatusOK, gin.H{"message": "identity revealed successfully"})
+}
+
+// GetThread handles a group member viewing the thread of a message
+func (h *ThreadHandler) GetThread(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Get message ID from URL
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+		return
+	}
+
+	// Get thread
+	message, replies, err := h.threadService.GetThread(messageID, userID.(uuid.UUID))
+	if err != nil {
+		writeThreadError(c, err)
+		return
+	}
+
+	// Convert to response format
+	response := make([]gin.H, 0, len(replies))
+	for i := range replies {
+		response = append(response, threadReplyResponse(&replies[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": messageResponse(message),
+		"replies": response,
+	})
+}
+
+// ReplyAsMember handles a group member replying in the thread of a message
+func (h *ThreadHandler) ReplyAsMember(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Get message ID from URL
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+		return
+	}
+
+	// Parse request
+	var req struct {
+		Content string `json:"content" binding:"required,max=2000"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Add reply
+	message, reply, err := h.threadService.ReplyAsMember(messageID, userID.(uuid.UUID), req.Content)
+	if err != nil {
+		writeThreadError(c, err)
+		return
+	}
+
+	// Notify subscribers of the group
+	publishMessageEvent(c, h.hub, realtime.EventReplyCreated, message, threadReplyResponse(reply))
+
+	c.JSON(http.StatusCreated, gin.H{"reply": threadReplyResponse(reply)})
+}
+
+// CloseThread handles a group member closing the thread of a message
+func (h *ThreadHandler) CloseThread(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Get message ID from URL
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+		return
+	}
+
+	// Close thread
+	message, err := h.threadService.CloseThread(messageID, userID.(uuid.UUID))
+	if err != nil {
+		writeThreadError(c, err)
+		return
+	}
+
+	// Notify subscribers of the group
+	publishMessageEvent(c, h.hub, realtime.EventMessageUpdated, message, messageResponse(message))
+
+	c.JSON(http.StatusOK, gin.H{"message": "conversation closed successfully"})
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/services"
+)
+
+// TwoFactorHandler handles two-factor authentication settings
+type TwoFactorHandler struct {
+	twoFactorService *services.TwoFactorService
+}
+
+// NewTwoFactorHandler creates a new two-factor handler
+func NewTwoFactorHandler(twoFactorService *services.TwoFactorService) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		twoFactorService: twoFactorService,
+	}
+}
+
+// Setup handles starting the enrollment in two-factor authentication
+func (h *TwoFactorHandler) Setup(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Generate secret
+	setup, err := h.twoFactorService.BeginSetup(userID.(uuid.UUID))
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	// The URI is what authenticator apps expect to find in the QR code
+	c.JSON(http.StatusOK, gin.H{
+		"secret":     setup.Secret,
+		"otpauthUri": setup.URI,
+		"qrData":     setup.URI,
+	})
+}
+
+// Enable handles confirming the enrollment with a first code
+func (h *TwoFactorHandler) Enable(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Parse request
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Enable two-factor authentication
+	codes, err := h.twoFactorService.Enable(userID.(uuid.UUID), req.Code)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	// Recovery codes are only shown once
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "two-factor authentication enabled successfully",
+		"recoveryCodes": codes,
+	})
+}
+
+// Disable handles turning two-factor authentication off
+func (h *TwoFactorHandler) Disable(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Parse request
+	var req struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Disable two-factor authentication
+	if err := h.twoFactorService.Disable(userID.(uuid.UUID), req.Password, req.Code); err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication disabled successfully"})
+}
+
+// RegenerateRecoveryCodes handles replacing the recovery codes of the user
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Parse request
+	var req struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Regenerate recovery codes
+	codes, err := h.twoFactorService.RegenerateRecoveryCodes(userID.(uuid.UUID), req.Password, req.Code)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+// writeTwoFactorError writes the response for a two-factor service error
+func writeTwoFactorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidPassword), errors.Is(err, services.ErrInvalidTwoFactorCode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTwoFactorEnabled),
+		errors.Is(err, services.ErrTwoFactorNotEnabled),
+		errors.Is(err, services.ErrTwoFactorSetupNotStarted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
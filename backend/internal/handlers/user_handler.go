@@ -39,15 +39,17 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 
 	// Return user without password
 	c.JSON(http.StatusOK, gin.H{
-		"id":           user.ID,
-		"email":        user.Email,
-		"name":         user.Name,
-		"avatarURL":    user.AvatarURL,
-		"isVerified":   user.IsVerified,
-		"plan":         user.Plan,
-		"messageCount": user.MessageCount,
-		"activeGroups": user.ActiveGroups,
-		"createdAt":    user.CreatedAt,
+		"id":                   user.ID,
+		"email":                user.Email,
+		"name":                 user.Name,
+		"avatarURL":            user.AvatarURL,
+		"isVerified":           user.IsVerified,
+		"twoFactorEnabled":     user.TOTPEnabled,
+		"plan":                 user.Plan,
+		"messageCount":         user.MessageCount,
+		"activeGroups":         user.ActiveGroups,
+		"deletionScheduledFor": user.DeletionScheduledFor,
+		"createdAt":            user.CreatedAt,
 	})
 }
 
@@ -141,3 +143,36 @@ func (h *UserHandler) UpdateNotifications(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "notification settings updated successfully"})
 }
+
+// GetUsage handles getting the user's message consumption for the current month
+func (h *UserHandler) GetUsage(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Get usage
+	usage, err := h.userService.GetMonthlyUsage(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A null limit means the plan is unlimited
+	var limit, remaining interface{}
+	if usage.Limit >= 0 {
+		limit = usage.Limit
+		remaining = usage.Remaining()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"period":      usage.Period,
+		"used":        usage.Used,
+		"limit":       limit,
+		"remaining":   remaining,
+		"periodStart": usage.PeriodStart,
+		"resetsAt":    usage.ResetsAt,
+	})
+}
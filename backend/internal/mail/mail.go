@@ -0,0 +1,41 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ralfferreira/papo-reto/internal/config"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Mail drivers
+const (
+	DriverSMTP   = "smtp"
+	DriverFile   = "file"
+	DriverMemory = "memory"
+)
+
+// NewMailer creates the mailer selected in the configuration
+func NewMailer(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case DriverSMTP:
+		return NewSMTPMailer(cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.From), nil
+	case DriverFile:
+		return NewFileMailer(cfg.OutboxDir, cfg.From)
+	case DriverMemory:
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("invalid mail driver: %q", cfg.Driver)
+	}
+}
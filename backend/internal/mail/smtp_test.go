@@ -0,0 +1,41 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSMTPMailerGivesUpOnHungServer(t *testing.T) {
+	// A server that accepts connections and never greets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	mailer := NewSMTPMailer(host, port, "", "", "Papo Reto <no-reply@example.com>")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := mailer.Send(ctx, Message{To: "a@example.com", Subject: "Oi", Body: "Oi"}); err == nil {
+		t.Fatal("expected an error from a hung server")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Send took %v, want it to give up at the deadline", elapsed)
+	}
+}
@@ -0,0 +1,130 @@
+package mail
+
+import (
+	"fmt"
+	"time"
+)
+
+// VerificationEmail builds the email asking a user to confirm their address
+func VerificationEmail(to, name, link string) Message {
+	return Message{
+		To:      to,
+		Subject: "Confirme seu e-mail no Papo Reto",
+		Body: fmt.Sprintf(`Olá, %s!
+
+Confirme seu endereço de e-mail acessando o link abaixo:
+
+%s
+
+O link expira em 24 horas. Se você não criou uma conta no Papo Reto, ignore este e-mail.
+`, name, link),
+	}
+}
+
+// PasswordResetEmail builds the email with a link to choose a new password
+func PasswordResetEmail(to, name, link string) Message {
+	return Message{
+		To:      to,
+		Subject: "Redefina sua senha do Papo Reto",
+		Body: fmt.Sprintf(`Olá, %s!
+
+Recebemos um pedido para redefinir a senha da sua conta. Para escolher uma nova senha, acesse o link abaixo:
+
+%s
+
+O link expira em 1 hora e só pode ser usado uma vez. Se você não fez esse pedido, ignore este e-mail; sua senha continua a mesma.
+`, name, link),
+	}
+}
+
+// MagicLinkEmail builds the email with a single-use sign-in link and the code to use instead of it
+func MagicLinkEmail(to, name, link, code string) Message {
+	return Message{
+		To:      to,
+		Subject: "Seu link de acesso ao Papo Reto",
+		Body: fmt.Sprintf(`Olá, %s!
+
+Para entrar no Papo Reto, acesse o link abaixo no mesmo navegador em que você pediu o acesso:
+
+%s
+
+Se o link abrir em outro navegador, digite este código na tela de login:
+
+%s
+
+O link e o código expiram em 15 minutos e só podem ser usados uma vez. Se você não pediu para entrar, ignore este e-mail.
+`, name, link, code),
+	}
+}
+
+// PasswordChangedEmail builds the email notifying a user that their password was reset
+func PasswordChangedEmail(to, name string) Message {
+	return Message{
+		To:      to,
+		Subject: "Sua senha do Papo Reto foi alterada",
+		Body: fmt.Sprintf(`Olá, %s!
+
+A senha da sua conta foi redefinida e todas as sessões abertas foram encerradas.
+
+Se não foi você, redefina sua senha imediatamente e entre em contato com o suporte.
+`, name),
+	}
+}
+
+// AccountLockedEmail builds the email warning a user that their account was locked after failed logins
+func AccountLockedEmail(to, name string, duration time.Duration) Message {
+	return Message{
+		To:      to,
+		Subject: "Sua conta do Papo Reto foi bloqueada temporariamente",
+		Body: fmt.Sprintf(`Olá, %s!
+
+Detectamos várias tentativas de login com senha incorreta na sua conta, então bloqueamos novos logins por %d minutos.
+
+Se foi você, aguarde e tente novamente. Se não foi, recomendamos redefinir sua senha e ativar a autenticação em dois fatores.
+`, name, int(duration.Minutes())),
+	}
+}
+
+// AccountDeletionScheduledEmail builds the email confirming that a user's account will be deleted
+func AccountDeletionScheduledEmail(to, name string, scheduledFor time.Time) Message {
+	return Message{
+		To:      to,
+		Subject: "Sua conta do Papo Reto será excluída",
+		Body: fmt.Sprintf(`Olá, %s!
+
+Recebemos seu pedido para excluir sua conta. Em %s sua conta, seus grupos e todas as mensagens recebidas serão apagados definitivamente.
+
+Até lá você pode cancelar a exclusão entrando no Papo Reto. Se não foi você que pediu, entre agora, cancele a exclusão e troque sua senha.
+`, name, scheduledFor.Format("02/01/2006 15:04")),
+	}
+}
+
+// AccountDeletedEmail builds the email confirming that a user's account was erased
+func AccountDeletedEmail(to, name string) Message {
+	return Message{
+		To:      to,
+		Subject: "Sua conta do Papo Reto foi excluída",
+		Body: fmt.Sprintf(`Olá, %s!
+
+Sua conta do Papo Reto foi excluída, com seus grupos e todas as mensagens recebidas. Este é o último e-mail que você receberá de nós.
+`, name),
+	}
+}
+
+// DataExportReadyEmail builds the email with the download link of a user's data export
+func DataExportReadyEmail(to, name, link string, expiresAt time.Time) Message {
+	return Message{
+		To:      to,
+		Subject: "Seus dados do Papo Reto estão prontos",
+		Body: fmt.Sprintf(`Olá, %s!
+
+O arquivo com seus dados do Papo Reto está pronto. Ele traz seu perfil, suas preferências de notificação, seus grupos, todas as mensagens recebidas e os compartilhamentos dos seus grupos.
+
+Baixe o arquivo pelo link abaixo:
+
+%s
+
+O link expira em %s. Depois disso, peça uma nova exportação. Se não foi você que pediu, troque sua senha.
+`, name, link, expiresAt.Format("02/01/2006 15:04")),
+	}
+}
@@ -6,20 +6,50 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/ralfferreira/papo-reto/internal/auth"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/services"
 )
 
 // AuthMiddleware is a middleware for authenticating requests
 type AuthMiddleware struct {
-	jwtService *auth.JWTService
+	jwtService     *auth.JWTService
+	sessionService *services.SessionService
+	apiKeyService  *services.APIKeyService
+	tickets        *auth.TicketStore
 }
 
 // NewAuthMiddleware creates a new auth middleware
-func NewAuthMiddleware(jwtService *auth.JWTService) *AuthMiddleware {
+func NewAuthMiddleware(jwtService *auth.JWTService, sessionService *services.SessionService, apiKeyService *services.APIKeyService, tickets *auth.TicketStore) *AuthMiddleware {
 	return &AuthMiddleware{
-		jwtService: jwtService,
+		jwtService:     jwtService,
+		sessionService: sessionService,
+		apiKeyService:  apiKeyService,
+		tickets:        tickets,
 	}
 }
 
+// authenticate validates a token and checks that its session has not been revoked
+func (m *AuthMiddleware) authenticate(c *gin.Context, tokenString string) (*auth.JWTClaims, error) {
+	claims, err := m.jwtService.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the session through the token's sid claim
+	if err := m.sessionService.CheckSession(c.Request.Context(), claims.SessionID); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// setClaims stores the authenticated user in the context
+func setClaims(c *gin.Context, claims *auth.JWTClaims) {
+	c.Set("userID", claims.UserID)
+	c.Set("email", claims.Email)
+	c.Set("sessionID", claims.SessionID)
+}
+
 // RequireAuth is a middleware that requires authentication
 func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -42,8 +72,15 @@ func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 		// Extract the token
 		tokenString := parts[1]
 
+		// API keys only reach the routes that accept them
+		if auth.IsAPIKey(tokenString) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot access this endpoint"})
+			c.Abort()
+			return
+		}
+
 		// Validate the token
-		claims, err := m.jwtService.ValidateToken(tokenString)
+		claims, err := m.authenticate(c, tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
@@ -51,14 +88,91 @@ func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 		}
 
 		// Set the user ID in the context
-		c.Set("userID", claims.UserID)
-		c.Set("email", claims.Email)
+		setClaims(c, claims)
+
+		// Continue to the next handler
+		c.Next()
+	}
+}
+
+// RequireAuthOrAPIKey is a middleware that requires authentication with an access token or an
+// API key. API keys are sent in the X-API-Key header or as a Bearer token, and routes behind
+// this middleware must check their scopes with RequireScope.
+func (m *AuthMiddleware) RequireAuthOrAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Get the API key or token
+		tokenString := c.GetHeader("X-API-Key")
+		if tokenString == "" {
+			authHeader := c.GetHeader("Authorization")
+			if authHeader == "" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+				c.Abort()
+				return
+			}
+
+			parts := strings.Split(authHeader, " ")
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header format must be Bearer {token}"})
+				c.Abort()
+				return
+			}
+			tokenString = parts[1]
+		}
+
+		if !auth.IsAPIKey(tokenString) {
+			// Validate the token
+			claims, err := m.authenticate(c, tokenString)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+				c.Abort()
+				return
+			}
+
+			setClaims(c, claims)
+			c.Next()
+			return
+		}
+
+		// Validate the API key
+		key, err := m.apiKeyService.Authenticate(tokenString)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or revoked API key"})
+			c.Abort()
+			return
+		}
+
+		// Set the user ID and the key in the context
+		c.Set("userID", key.UserID)
+		c.Set("apiKey", key)
 
 		// Continue to the next handler
 		c.Next()
 	}
 }
 
+// RequireScope is a middleware that requires requests authenticated with an API key to have
+// one of scopes, requests authenticated with an access token are not restricted
+func (m *AuthMiddleware) RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, exists := c.Get("apiKey")
+		if !exists {
+			c.Next()
+			return
+		}
+
+		key := value.(*models.APIKey)
+		for _, scope := range scopes {
+			if key.HasScope(scope) {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "API key requires one of the scopes: " + strings.Join(scopes, ", ")})
+		c.Abort()
+	}
+}
+
 // OptionalAuth is a middleware that attempts authentication but doesn't require it
 func (m *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -82,7 +196,7 @@ func (m *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
 		tokenString := parts[1]
 
 		// Validate the token
-		claims, err := m.jwtService.ValidateToken(tokenString)
+		claims, err := m.authenticate(c, tokenString)
 		if err != nil {
 			// Invalid token, continue without authentication
 			c.Next()
@@ -90,8 +204,52 @@ func (m *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
 		}
 
 		// Set the user ID in the context
-		c.Set("userID", claims.UserID)
-		c.Set("email", claims.Email)
+		setClaims(c, claims)
+
+		// Continue to the next handler
+		c.Next()
+	}
+}
+
+// RequireStreamAuth is a middleware that requires authentication for streaming endpoints.
+// Browsers cannot set headers on WebSocket or EventSource requests, so they send a ticket
+// from POST /api/v1/realtime/tickets in the ticket query parameter instead. Access tokens
+// are only accepted in the Authorization header, URLs end up in access logs.
+func (m *AuthMiddleware) RequireStreamAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var claims *auth.JWTClaims
+		var err error
+
+		if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+			parts := strings.Split(authHeader, " ")
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header format must be Bearer {token}"})
+				c.Abort()
+				return
+			}
+
+			// Validate the token
+			claims, err = m.authenticate(c, parts[1])
+		} else if ticket := c.Query("ticket"); ticket != "" {
+			// Redeem the ticket, the session may have been revoked since it was issued
+			claims, err = m.tickets.Redeem(c.Request.Context(), ticket)
+			if err == nil {
+				err = m.sessionService.CheckSession(c.Request.Context(), claims.SessionID)
+			}
+		} else {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header or stream ticket required"})
+			c.Abort()
+			return
+		}
+
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+
+		// Set the user ID in the context
+		setClaims(c, claims)
 
 		// Continue to the next handler
 		c.Next()
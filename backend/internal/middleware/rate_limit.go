@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ralfferreira/papo-reto/internal/auth"
+	"github.com/ralfferreira/papo-reto/internal/config"
+	"github.com/ralfferreira/papo-reto/internal/ratelimit"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+)
+
+// maxPeekedRequestBody is the size of the request body the rate limits read their keys from
+const maxPeekedRequestBody = 64 << 10
+
+// rateLimitCheck is a limit applied to a rate limiting key
+type rateLimitCheck struct {
+	key   string
+	limit ratelimit.Limit
+}
+
+// SendRateLimit is a middleware that throttles anonymous messages sent to a group.
+// Requests are limited per client IP, per client IP and group, and per group; the
+// last two limits can be tuned in the group settings.
+func SendRateLimit(limiter ratelimit.Limiter, groupRepo *repository.MessageGroupRepository, cfg config.RateLimitConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := c.ClientIP()
+		slug := c.Param("slug")
+
+		// Owners may tune the limits of their group, values out of bounds are ignored
+		perSender := ratelimit.Limit{Requests: cfg.PerIPGroup, Window: cfg.Window}
+		perGroup := ratelimit.Limit{Requests: cfg.PerGroup, Window: cfg.Window}
+		if group, err := groupRepo.GetBySlug(slug); err == nil {
+			settings := group.GetRateLimitSettings()
+			if settings.WindowSeconds >= ratelimit.MinWindowSeconds && settings.WindowSeconds <= ratelimit.MaxWindowSeconds {
+				perSender.Window = time.Duration(settings.WindowSeconds) * time.Second
+				perGroup.Window = perSender.Window
+			}
+			if settings.PerSender > 0 && settings.PerSender <= ratelimit.MaxPerSender {
+				perSender.Requests = settings.PerSender
+			}
+			if settings.PerGroup > 0 && settings.PerGroup <= ratelimit.MaxPerGroup {
+				perGroup.Requests = settings.PerGroup
+			}
+		}
+
+		checks := []rateLimitCheck{
+			{key: "ip:" + ip, limit: ratelimit.Limit{Requests: cfg.PerIP, Window: cfg.Window}},
+			{key: "ip-group:" + ip + ":" + slug, limit: perSender},
+			{key: "group:" + slug, limit: perGroup},
+		}
+
+		if !enforceRateLimits(c, limiter, checks, "too many messages, please try again later") {
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// EmailRateLimit is a middleware that throttles the endpoints emailing the address in the
+// "email" field of the request body. Requests are limited per client IP and per address,
+// shared by every such endpoint, so they cannot be used to flood a mailbox.
+func EmailRateLimit(limiter ratelimit.Limiter, cfg config.RateLimitConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		checks := []rateLimitCheck{
+			{key: "email-ip:" + c.ClientIP(), limit: ratelimit.Limit{Requests: cfg.EmailPerIP, Window: cfg.EmailWindow}},
+		}
+
+		var req struct {
+			Email string `json:"email"`
+		}
+		if !peekJSONBody(c, &req) {
+			return
+		}
+		if req.Email != "" {
+			// Keys hold a hash so the addresses are not stored in Redis
+			address := auth.HashToken(strings.ToLower(strings.TrimSpace(req.Email)))
+			checks = append(checks, rateLimitCheck{
+				key:   "email-address:" + address,
+				limit: ratelimit.Limit{Requests: cfg.EmailPerAddress, Window: cfg.EmailWindow},
+			})
+		}
+
+		if !enforceRateLimits(c, limiter, checks, "too many emails requested, please try again later") {
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ReplyRateLimit is a middleware that throttles the follow-ups anonymous senders post with
+// the receipt token in the "token" field of the request body. Requests are limited per client
+// IP and per thread.
+func ReplyRateLimit(limiter ratelimit.Limiter, cfg config.RateLimitConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		checks := []rateLimitCheck{
+			{key: "reply-ip:" + c.ClientIP(), limit: ratelimit.Limit{Requests: cfg.ReplyPerIP, Window: cfg.ReplyWindow}},
+		}
+
+		var req struct {
+			Token string `json:"token"`
+		}
+		if !peekJSONBody(c, &req) {
+			return
+		}
+		if req.Token != "" {
+			// Keys hold a hash so the receipt tokens are not stored in Redis
+			checks = append(checks, rateLimitCheck{
+				key:   "reply-thread:" + auth.HashToken(req.Token),
+				limit: ratelimit.Limit{Requests: cfg.ReplyPerThread, Window: cfg.ReplyWindow},
+			})
+		}
+
+		if !enforceRateLimits(c, limiter, checks, "too many replies, please try again later") {
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// peekJSONBody decodes the JSON request body into dst, if it is JSON, and puts the body back
+// for the handler. It writes a 400 response and returns false when the body cannot be read.
+func peekJSONBody(c *gin.Context, dst interface{}) bool {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPeekedRequestBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		c.Abort()
+		return false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	_ = json.Unmarshal(body, dst)
+	return true
+}
+
+// enforceRateLimits records the request against each check in order, stopping at the first
+// exceeded one, and sets the rate limit headers of the most restrictive limit. It writes a
+// 429 response and returns false when a limit is exceeded.
+func enforceRateLimits(c *gin.Context, limiter ratelimit.Limiter, checks []rateLimitCheck, message string) bool {
+	// Report the most restrictive limit
+	var reported *ratelimit.Result
+	for _, check := range checks {
+		result, err := limiter.Allow(c.Request.Context(), check.key, check.limit)
+		if err != nil {
+			// Fail open, an unavailable limiter must not take the endpoint down
+			log.Printf("Failed to check rate limit: %v", err)
+			continue
+		}
+
+		if reported == nil || !result.Allowed || result.Remaining < reported.Remaining {
+			reported = &result
+		}
+
+		if !result.Allowed {
+			break
+		}
+	}
+
+	if reported == nil {
+		return true
+	}
+
+	c.Header("X-RateLimit-Limit", strconv.Itoa(reported.Limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(reported.Remaining))
+	c.Header("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(reported.ResetAfter).Unix(), 10))
+
+	if !reported.Allowed {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(reported.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": message})
+		c.Abort()
+		return false
+	}
+
+	return true
+}
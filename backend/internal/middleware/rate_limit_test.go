@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ralfferreira/papo-reto/internal/config"
+	"github.com/ralfferreira/papo-reto/internal/ratelimit"
+)
+
+func newEmailRateLimitRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.RateLimitConfig{EmailPerIP: 5, EmailPerAddress: 2, EmailWindow: time.Hour}
+	limit := EmailRateLimit(ratelimit.NewMemoryLimiter(), cfg)
+
+	// The handlers echo the body to show it still reaches them
+	echo := func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	}
+
+	router := gin.New()
+	router.POST("/forgot-password", limit, echo)
+	router.POST("/magic-link", limit, echo)
+	return router
+}
+
+func postEmail(router *gin.Engine, path, body, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = ip + ":1234"
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestEmailRateLimitPerAddress(t *testing.T) {
+	router := newEmailRateLimitRouter()
+	body := `{"email": "alvo@example.com"}`
+
+	// The limit is shared by the endpoints and ignores case, whatever the IP
+	requests := []struct {
+		path, body, ip string
+		want           int
+	}{
+		{"/forgot-password", body, "10.0.0.1", http.StatusOK},
+		{"/magic-link", `{"email": "ALVO@example.com "}`, "10.0.0.2", http.StatusOK},
+		{"/forgot-password", body, "10.0.0.3", http.StatusTooManyRequests},
+		{"/magic-link", body, "10.0.0.4", http.StatusTooManyRequests},
+		{"/forgot-password", `{"email": "outro@example.com"}`, "10.0.0.5", http.StatusOK},
+	}
+
+	for i, r := range requests {
+		w := postEmail(router, r.path, r.body, r.ip)
+		if w.Code != r.want {
+			t.Fatalf("request %d: status = %d, want %d", i+1, w.Code, r.want)
+		}
+		if r.want == http.StatusOK && w.Body.String() != r.body {
+			t.Errorf("request %d: handler got body %q, want %q", i+1, w.Body.String(), r.body)
+		}
+		if r.want == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Errorf("request %d: missing Retry-After header", i+1)
+		}
+	}
+}
+
+func TestEmailRateLimitPerIP(t *testing.T) {
+	router := newEmailRateLimitRouter()
+
+	for i := 0; i < 5; i++ {
+		body := `{"email": "alvo` + string(rune('a'+i)) + `@example.com"}`
+		if w := postEmail(router, "/forgot-password", body, "10.0.0.1"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want %d", i+1, w.Code, http.StatusOK)
+		}
+	}
+
+	if w := postEmail(router, "/forgot-password", `{"email": "novo@example.com"}`, "10.0.0.1"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if w := postEmail(router, "/forgot-password", `{"email": "novo@example.com"}`, "10.0.0.2"); w.Code != http.StatusOK {
+		t.Fatalf("status = %d from another IP, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestReplyRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.RateLimitConfig{ReplyPerIP: 3, ReplyPerThread: 2, ReplyWindow: time.Minute}
+	router := gin.New()
+	router.POST("/threads/replies", ReplyRateLimit(ratelimit.NewMemoryLimiter(), cfg), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	// Each thread takes 2 replies whatever the IP, and each IP 3 whatever the thread
+	requests := []struct {
+		token, ip string
+		want      int
+	}{
+		{"a", "10.0.0.1", http.StatusCreated},
+		{"a", "10.0.0.2", http.StatusCreated},
+		{"a", "10.0.0.3", http.StatusTooManyRequests},
+		{"b", "10.0.0.4", http.StatusCreated},
+		{"c", "10.0.0.4", http.StatusCreated},
+		{"d", "10.0.0.4", http.StatusCreated},
+		{"e", "10.0.0.4", http.StatusTooManyRequests},
+	}
+
+	for i, r := range requests {
+		if w := postEmail(router, "/threads/replies", `{"token": "`+r.token+`", "content": "oi"}`, r.ip); w.Code != r.want {
+			t.Fatalf("request %d: status = %d, want %d", i+1, w.Code, r.want)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AccountTombstone records that a user's account was purged and what was erased with it.
+// It keeps no personal data, not even a hash of the email.
+type AccountTombstone struct {
+	ID                  uuid.UUID `gorm:"type:uuid;primary_key"`
+	UserID              uuid.UUID `gorm:"type:uuid;uniqueIndex"`
+	DeletionRequestedAt *time.Time
+	PurgedAt            time.Time
+	GroupsDeleted       int64
+	MessagesDeleted     int64
+	SharedAccessDeleted int64
+	SessionsDeleted     int64
+	CreatedAt           time.Time
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (t *AccountTombstone) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Scopes of API keys
+const (
+	APIKeyScopeMessagesRead  = "messages:read"
+	APIKeyScopeMessagesWrite = "messages:write"
+	APIKeyScopeGroupsManage  = "groups:manage"
+)
+
+// APIKeyScopes lists every scope an API key can be granted
+var APIKeyScopes = []string{APIKeyScopeMessagesRead, APIKeyScopeMessagesWrite, APIKeyScopeGroupsManage}
+
+// APIKey represents a personal key a user's scripts authenticate with, only its SHA-256 hash is stored
+type APIKey struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key"`
+	UserID     uuid.UUID `gorm:"type:uuid;index"`
+	Name       string    `gorm:"size:100"`
+	Prefix     string    `gorm:"size:16"` // First characters of the key, shown so users can tell keys apart
+	KeyHash    string    `gorm:"size:64;uniqueIndex"`
+	Scopes     string    `gorm:"size:255"` // Space separated
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+
+	User User `gorm:"foreignKey:UserID"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (k *APIKey) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == uuid.Nil {
+		k.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsRevoked checks if the key has been revoked
+func (k *APIKey) IsRevoked() bool {
+	return k.RevokedAt != nil
+}
+
+// GetScopes returns the scopes granted to the key
+func (k *APIKey) GetScopes() []string {
+	return strings.Fields(k.Scopes)
+}
+
+// HasScope checks if the key was granted a scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, granted := range k.GetScopes() {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidAPIKeyScope checks if a scope can be granted to API keys
+func IsValidAPIKeyScope(scope string) bool {
+	for _, valid := range APIKeyScopes {
+		if scope == valid {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Statuses of a data export
+const (
+	DataExportStatusPending   = "pending"
+	DataExportStatusRunning   = "running"
+	DataExportStatusCompleted = "completed"
+	DataExportStatusFailed    = "failed"
+)
+
+// DataExport represents a user's request for an archive of their personal data
+type DataExport struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key"`
+	UserID      uuid.UUID  `gorm:"type:uuid;index"`
+	Status      string     `gorm:"size:20;default:'pending';index"`
+	FilePath    string     `gorm:"size:500"`
+	SizeBytes   int64      `gorm:"default:0"`
+	TokenHash   string     `gorm:"size:64;index"` // Hash of the token in the download link
+	Instance    string     `gorm:"size:255"`      // Instance whose worker claimed the export and wrote its archive
+	StartedAt   *time.Time // Set when a worker claims the export
+	CompletedAt *time.Time
+	ExpiresAt   *time.Time // The download link and the archive are gone after this
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (e *DataExport) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsInProgress checks if the export is still waiting for or being built by a worker
+func (e *DataExport) IsInProgress() bool {
+	return e.Status == DataExportStatusPending || e.Status == DataExportStatusRunning
+}
+
+// IsDownloadable checks if the archive is ready and its link has not expired
+func (e *DataExport) IsDownloadable(now time.Time) bool {
+	return e.Status == DataExportStatusCompleted && e.ExpiresAt != nil && now.Before(*e.ExpiresAt)
+}
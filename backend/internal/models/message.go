@@ -7,19 +7,38 @@ import (
 	"gorm.io/gorm"
 )
 
+// Moderation statuses of a message
+const (
+	ModerationStatusApproved = "approved"
+	ModerationStatusPending  = "pending"
+	ModerationStatusRejected = "rejected"
+)
+
 // Message represents an anonymous message sent to a group
 type Message struct {
 	ID         uuid.UUID `gorm:"type:uuid;primary_key"`
 	GroupID    uuid.UUID `gorm:"type:uuid;index"`
 	Content    string    `gorm:"type:text"`
 	SenderIP   string    `gorm:"size:50"`
-	SenderID   *string   `gorm:"size:255"` // Optional, for revealed identity
+	SenderID   *string   `gorm:"size:255"` // ID of the signed in user who revealed their identity
+	SenderName string    `gorm:"size:100"` // Their name when they revealed it
+	Icebreaker string    `gorm:"size:200"` // Icebreaker question of the group the message answers
 	IsRead     bool      `gorm:"default:false"`
 	IsFavorite bool      `gorm:"default:false"`
 	IsRevealed bool      `gorm:"default:false"`
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
-	DeletedAt  *time.Time `gorm:"index"`
+	// Only approved messages reach the inbox, pending ones wait in the moderation queue
+	ModerationStatus string     `gorm:"size:20;default:'approved';index"`
+	ModerationReason string     `gorm:"size:500"`
+	Answer           string     `gorm:"type:text"`
+	AnsweredAt       *time.Time `gorm:"index"`
+	AnsweredBy       *uuid.UUID `gorm:"type:uuid"`
+	IsAnswerPublic   bool       `gorm:"default:false"`   // Listed on the group's public answers page
+	ReceiptTokenHash string     `gorm:"size:64;index"`   // Hash of the token the sender follows the thread with
+	SenderUserID     *uuid.UUID `gorm:"type:uuid;index"` // Signed in user who sent the message, never shown; only they can reveal themselves
+	ThreadClosedAt   *time.Time // No more replies once the group closes the thread
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	DeletedAt        *time.Time `gorm:"index"`
 
 	// Define this as a belongs-to relationship with the correct references
 	Group MessageGroup `gorm:"foreignKey:GroupID;references:ID"`
@@ -43,10 +62,55 @@ func (m *Message) ToggleFavorite() {
 	m.IsFavorite = !m.IsFavorite
 }
 
-// RevealIdentity marks the message as having a revealed identity
-func (m *Message) RevealIdentity(senderID string) {
+// RevealIdentity marks the message as sent by a user who revealed their identity
+func (m *Message) RevealIdentity(sender *User) {
+	senderID := sender.ID.String()
 	m.IsRevealed = true
 	m.SenderID = &senderID
+	m.SenderName = sender.Name
+}
+
+// IsPending checks if the message is waiting in the moderation queue
+func (m *Message) IsPending() bool {
+	return m.ModerationStatus == ModerationStatusPending
+}
+
+// Approve releases the message to the inbox
+func (m *Message) Approve() {
+	m.ModerationStatus = ModerationStatusApproved
+}
+
+// Reject keeps the message out of the inbox
+func (m *Message) Reject(reason string) {
+	m.ModerationStatus = ModerationStatusRejected
+	m.ModerationReason = reason
+}
+
+// IsAnswered checks if the message has an answer
+func (m *Message) IsAnswered() bool {
+	return m.AnsweredAt != nil
+}
+
+// SetAnswer answers the message, publicly or only for the group's members
+func (m *Message) SetAnswer(answer string, answeredBy uuid.UUID, public bool) {
+	now := time.Now()
+	m.Answer = answer
+	m.AnsweredAt = &now
+	m.AnsweredBy = &answeredBy
+	m.IsAnswerPublic = public
+}
+
+// ClearAnswer removes the answer of the message
+func (m *Message) ClearAnswer() {
+	m.Answer = ""
+	m.AnsweredAt = nil
+	m.AnsweredBy = nil
+	m.IsAnswerPublic = false
+}
+
+// IsThreadClosed checks if the thread of the message no longer takes replies
+func (m *Message) IsThreadClosed() bool {
+	return m.ThreadClosedAt != nil
 }
 
 // AnonymizeIP anonymizes the sender's IP address for privacy
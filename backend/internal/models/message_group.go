@@ -27,6 +27,19 @@ type MessageGroup struct {
 	Messages []Message `gorm:"foreignKey:GroupID;references:ID"`
 }
 
+// RateLimitSettings holds the anonymous sending limits tuned by the group owner
+type RateLimitSettings struct {
+	PerSender     int `json:"perSender"`
+	PerGroup      int `json:"perGroup"`
+	WindowSeconds int `json:"windowSeconds"`
+}
+
+// ThemeSettings holds the colors of the group's public page
+type ThemeSettings struct {
+	PrimaryColor    string `json:"primaryColor,omitempty"`
+	BackgroundColor string `json:"backgroundColor,omitempty"`
+}
+
 // BeforeCreate will set a UUID rather than numeric ID
 func (mg *MessageGroup) BeforeCreate(tx *gorm.DB) error {
 	if mg.ID == uuid.Nil {
@@ -57,6 +70,33 @@ func (mg *MessageGroup) GetIcebreakers() []string {
 	return settings.Icebreakers
 }
 
+// HasIcebreaker checks if a question is one of the group's icebreakers
+func (mg *MessageGroup) HasIcebreaker(question string) bool {
+	for _, icebreaker := range mg.GetIcebreakers() {
+		if icebreaker == question {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTheme returns the theme of the group's public page
+func (mg *MessageGroup) GetTheme() ThemeSettings {
+	if mg.Settings == nil {
+		return ThemeSettings{}
+	}
+
+	var settings struct {
+		Theme ThemeSettings `json:"theme"`
+	}
+
+	if err := json.Unmarshal(mg.Settings, &settings); err != nil {
+		return ThemeSettings{}
+	}
+
+	return settings.Theme
+}
+
 // GetBannedWords returns the list of banned words for content moderation
 func (mg *MessageGroup) GetBannedWords() []string {
 	if mg.Settings == nil {
@@ -73,3 +113,71 @@ func (mg *MessageGroup) GetBannedWords() []string {
 
 	return settings.BannedWords
 }
+
+// GetBannedPatterns returns the regular expressions rejected by content moderation
+func (mg *MessageGroup) GetBannedPatterns() []string {
+	if mg.Settings == nil {
+		return []string{}
+	}
+
+	var settings struct {
+		BannedPatterns []string `json:"bannedPatterns"`
+	}
+
+	if err := json.Unmarshal(mg.Settings, &settings); err != nil {
+		return []string{}
+	}
+
+	return settings.BannedPatterns
+}
+
+// GetModerationAction returns what happens to messages flagged by content moderation
+func (mg *MessageGroup) GetModerationAction() string {
+	if mg.Settings == nil {
+		return ""
+	}
+
+	var settings struct {
+		ModerationAction string `json:"moderationAction"`
+	}
+
+	if err := json.Unmarshal(mg.Settings, &settings); err != nil {
+		return ""
+	}
+
+	return settings.ModerationAction
+}
+
+// IsReviewBeforeInbox returns whether every message must be approved before reaching the inbox
+func (mg *MessageGroup) IsReviewBeforeInbox() bool {
+	if mg.Settings == nil {
+		return false
+	}
+
+	var settings struct {
+		ReviewBeforeInbox bool `json:"reviewBeforeInbox"`
+	}
+
+	if err := json.Unmarshal(mg.Settings, &settings); err != nil {
+		return false
+	}
+
+	return settings.ReviewBeforeInbox
+}
+
+// GetRateLimitSettings returns the anonymous sending limits configured for this group
+func (mg *MessageGroup) GetRateLimitSettings() RateLimitSettings {
+	if mg.Settings == nil {
+		return RateLimitSettings{}
+	}
+
+	var settings struct {
+		RateLimit RateLimitSettings `json:"rateLimit"`
+	}
+
+	if err := json.Unmarshal(mg.Settings, &settings); err != nil {
+		return RateLimitSettings{}
+	}
+
+	return settings.RateLimit
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MonthlyUsage counts the messages a user's groups received in a calendar month
+type MonthlyUsage struct {
+	UserID       uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Period       string    `gorm:"size:7;primaryKey"` // Month in the YYYY-MM format
+	MessageCount int       `gorm:"default:0"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// UsagePeriod returns the usage period containing t
+func UsagePeriod(t time.Time) string {
+	return t.Format("2006-01")
+}
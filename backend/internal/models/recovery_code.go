@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RecoveryCode represents a one-time code that replaces a TOTP code when the user
+// has lost their authenticator, only its SHA-256 hash is stored
+type RecoveryCode struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key"`
+	UserID    uuid.UUID `gorm:"type:uuid;index"`
+	CodeHash  string    `gorm:"size:64"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (rc *RecoveryCode) BeforeCreate(tx *gorm.DB) error {
+	if rc.ID == uuid.Nil {
+		rc.ID = uuid.New()
+	}
+	return nil
+}
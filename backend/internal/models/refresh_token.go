@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RefreshToken represents an opaque refresh token, only its SHA-256 hash is stored
+type RefreshToken struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key"`
+	SessionID uuid.UUID `gorm:"type:uuid;index"`
+	TokenHash string    `gorm:"size:64;uniqueIndex"`
+	ExpiresAt time.Time
+	// Set when the token is exchanged, a used token is never accepted again
+	UsedAt    *time.Time
+	CreatedAt time.Time
+
+	Session Session `gorm:"foreignKey:SessionID"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (rt *RefreshToken) BeforeCreate(tx *gorm.DB) error {
+	if rt.ID == uuid.Nil {
+		rt.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsExpired checks if the refresh token has expired
+func (rt *RefreshToken) IsExpired() bool {
+	return time.Now().After(rt.ExpiresAt)
+}
+
+// IsUsed checks if the refresh token has already been exchanged
+func (rt *RefreshToken) IsUsed() bool {
+	return rt.UsedAt != nil
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Session represents a login of a user. Every refresh token issued by rotation
+// belongs to the session it started from, so a session is a refresh token family.
+type Session struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key"`
+	UserID      uuid.UUID `gorm:"type:uuid;index"`
+	UserAgent   string    `gorm:"size:255"`
+	IPAddress   string    `gorm:"size:45"` // Truncated to the network, the full address is not kept
+	DeviceLabel string    `gorm:"size:100"`
+	LastSeenAt  time.Time
+	RevokedAt   *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+
+	User User `gorm:"foreignKey:UserID"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (s *Session) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsRevoked checks if the session has been revoked
+func (s *Session) IsRevoked() bool {
+	return s.RevokedAt != nil
+}
@@ -7,20 +7,32 @@ import (
 	"gorm.io/gorm"
 )
 
+// Roles a user can have in a message group
+const (
+	RoleOwner     = "owner"
+	RoleEditor    = "editor"
+	RoleModerator = "moderator"
+	RoleViewer    = "viewer"
+)
+
 // SharedAccess represents shared access to a message group
 type SharedAccess struct {
-	ID        uuid.UUID  `gorm:"type:uuid;primary_key"`
-	GroupID   uuid.UUID  `gorm:"type:uuid;index"`
-	InvitedBy uuid.UUID  `gorm:"type:uuid"`
-	Email     string     `gorm:"size:255"`
-	Token     string     `gorm:"size:100;uniqueIndex"`
-	IsActive  bool       `gorm:"default:true"`
+	ID        uuid.UUID `gorm:"type:uuid;primary_key"`
+	GroupID   uuid.UUID `gorm:"type:uuid;index"`
+	InvitedBy uuid.UUID `gorm:"type:uuid"`
+	Email     string    `gorm:"size:255"`
+	Token     string    `gorm:"size:100;uniqueIndex"`
+	Role      string    `gorm:"size:20;default:'viewer'"`
+	IsActive  bool      `gorm:"default:true"`
 	ExpiresAt *time.Time
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	
-	Group     MessageGroup `gorm:"foreignKey:GroupID"`
-	Inviter   User         `gorm:"foreignKey:InvitedBy"`
+	// Set when the invitee redeems the token
+	UserID     *uuid.UUID `gorm:"type:uuid;index"`
+	AcceptedAt *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+
+	Group   MessageGroup `gorm:"foreignKey:GroupID"`
+	Inviter User         `gorm:"foreignKey:InvitedBy"`
 }
 
 // BeforeCreate will set a UUID rather than numeric ID
@@ -44,6 +56,18 @@ func (sa *SharedAccess) IsValid() bool {
 	return sa.IsActive && !sa.IsExpired()
 }
 
+// IsAccepted checks if the invitation has been redeemed
+func (sa *SharedAccess) IsAccepted() bool {
+	return sa.UserID != nil
+}
+
+// Accept binds the invitation to the user who redeemed it
+func (sa *SharedAccess) Accept(userID uuid.UUID) {
+	now := time.Now()
+	sa.UserID = &userID
+	sa.AcceptedAt = &now
+}
+
 // Revoke deactivates the shared access
 func (sa *SharedAccess) Revoke() {
 	sa.IsActive = false
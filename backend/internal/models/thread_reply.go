@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Authors of a thread reply
+const (
+	ThreadAuthorOwner  = "owner"
+	ThreadAuthorSender = "sender"
+)
+
+// ThreadReply represents a reply in the conversation between a group and the anonymous sender of a message
+type ThreadReply struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key"`
+	MessageID  uuid.UUID  `gorm:"type:uuid;index"`
+	AuthorType string     `gorm:"size:10"`
+	AuthorID   *uuid.UUID `gorm:"type:uuid;index"` // Member who replied for the group, never set for the sender
+	Content    string     `gorm:"type:text"`
+	CreatedAt  time.Time
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (r *ThreadReply) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsFromSender checks if the reply was written by the anonymous sender
+func (r *ThreadReply) IsFromSender() bool {
+	return r.AuthorType == ThreadAuthorSender
+}
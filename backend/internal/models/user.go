@@ -10,19 +10,25 @@ import (
 
 // User represents a registered user in the system
 type User struct {
-	ID             uuid.UUID       `gorm:"type:uuid;primary_key"`
-	Email          string          `gorm:"size:255;uniqueIndex"`
-	Password       string          `gorm:"size:255"`
-	Name           string          `gorm:"size:100"`
-	AvatarURL      string          `gorm:"size:255"`
-	IsVerified     bool            `gorm:"default:false"`
-	Plan           string          `gorm:"size:50;default:'free'"`
-	MessageCount   int             `gorm:"default:0"`
-	ActiveGroups   int             `gorm:"default:0"`
-	NotifySettings json.RawMessage `gorm:"type:jsonb"`
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	DeletedAt      *time.Time `gorm:"index"`
+	ID                   uuid.UUID       `gorm:"type:uuid;primary_key"`
+	Email                string          `gorm:"size:255;uniqueIndex"`
+	Password             string          `gorm:"size:255"`
+	Name                 string          `gorm:"size:100"`
+	AvatarURL            string          `gorm:"size:255"`
+	IsVerified           bool            `gorm:"default:false"`
+	VerificationRequired bool            `gorm:"default:false"` // Set at sign up, accounts created before email verification keep their group limit
+	Plan                 string          `gorm:"size:50;default:'free'"`
+	MessageCount         int             `gorm:"default:0"`
+	ActiveGroups         int             `gorm:"default:0"`
+	NotifySettings       json.RawMessage `gorm:"type:jsonb"`
+	TOTPSecret           string          `gorm:"size:64"` // Set at enrollment, in use once TOTPEnabled
+	TOTPEnabled          bool            `gorm:"default:false"`
+	TOTPLastCounter      int64           `gorm:"default:0"` // Time step of the last accepted code, codes cannot be reused
+	DeletionRequestedAt  *time.Time      // Set while the user's deletion can still be cancelled
+	DeletionScheduledFor *time.Time      `gorm:"index"` // The account is purged once this passes
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	DeletedAt            *time.Time `gorm:"index"`
 }
 
 // BeforeCreate will set a UUID rather than numeric ID
@@ -33,6 +39,11 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// IsDeletionScheduled checks if the user asked for their account to be deleted
+func (u *User) IsDeletionScheduled() bool {
+	return u.DeletionScheduledFor != nil
+}
+
 // IsPremium checks if the user has a premium plan
 func (u *User) IsPremium() bool {
 	return u.Plan == "premium"
@@ -40,6 +51,9 @@ func (u *User) IsPremium() bool {
 
 // GetGroupLimit returns the maximum number of active groups allowed for the user's plan
 func (u *User) GetGroupLimit() int {
+	if u.VerificationRequired && !u.IsVerified {
+		return 1 // Unverified accounts get a single group until they confirm their email
+	}
 	if u.IsPremium() {
 		return -1 // Unlimited
 	}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UserIdentity links a user to an account at an external OpenID Connect provider
+type UserIdentity struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key"`
+	UserID    uuid.UUID `gorm:"type:uuid;index"`
+	Provider  string    `gorm:"size:50;uniqueIndex:idx_user_identities_provider_subject"`
+	Subject   string    `gorm:"size:255;uniqueIndex:idx_user_identities_provider_subject"`
+	Email     string    `gorm:"size:255"` // Email reported by the provider when the identity was linked
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	User User `gorm:"foreignKey:UserID"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (i *UserIdentity) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Purposes of user tokens
+const (
+	TokenPurposePasswordReset = "password_reset"
+	TokenPurposeMagicLink     = "magic_link"
+)
+
+// UserToken represents a single-use token emailed to a user, only its SHA-256 hash is stored
+type UserToken struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key"`
+	UserID      uuid.UUID `gorm:"type:uuid;index"`
+	Purpose     string    `gorm:"size:50;index"`
+	TokenHash   string    `gorm:"size:64;uniqueIndex"`
+	BindingHash string    `gorm:"size:64;index"` // Magic links only: hash of the cookie of the browser that requested the link
+	CodeHash    string    `gorm:"size:64"`       // Magic links only: hash of the code to type in that browser instead
+	Attempts    int       `gorm:"default:0"`     // Wrong codes entered
+	ExpiresAt   time.Time
+	UsedAt      *time.Time
+	CreatedAt   time.Time
+
+	User User `gorm:"foreignKey:UserID"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (t *UserToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsValid checks if the token has not been used and has not expired
+func (t *UserToken) IsValid() bool {
+	return t.UsedAt == nil && time.Now().Before(t.ExpiresAt)
+}
@@ -0,0 +1,328 @@
+package moderation
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ralfferreira/papo-reto/internal/models"
+)
+
+// Action is what happens to a message flagged by moderation
+type Action string
+
+// Moderation actions
+const (
+	ActionAllow      Action = "allow"
+	ActionReject     Action = "reject"
+	ActionMask       Action = "mask"
+	ActionQuarantine Action = "quarantine"
+)
+
+// ParseAction parses a moderation action configured in group settings
+func ParseAction(value string) (Action, error) {
+	switch Action(value) {
+	case ActionReject, ActionMask, ActionQuarantine:
+		return Action(value), nil
+	case "":
+		return ActionReject, nil
+	default:
+		return "", fmt.Errorf("invalid moderation action: %q", value)
+	}
+}
+
+// Match is a span of content flagged by a check, in byte offsets
+type Match struct {
+	Check  string
+	Reason string
+	Start  int
+	End    int
+}
+
+// Check inspects message content and reports the spans it flags
+type Check interface {
+	Name() string
+	Inspect(content string) []Match
+}
+
+// Result is the outcome of running a message through the pipeline
+type Result struct {
+	Action  Action
+	Content string
+	Matches []Match
+}
+
+// Reasons returns the distinct reasons the content was flagged
+func (r Result) Reasons() []string {
+	seen := make(map[string]bool)
+	var reasons []string
+	for _, match := range r.Matches {
+		if !seen[match.Reason] {
+			seen[match.Reason] = true
+			reasons = append(reasons, match.Reason)
+		}
+	}
+	return reasons
+}
+
+// Summary returns the reasons joined in a single line of at most maxLength bytes
+func (r Result) Summary(maxLength int) string {
+	summary := strings.Join(r.Reasons(), "; ")
+	if len(summary) <= maxLength {
+		return summary
+	}
+
+	// Cut on a rune boundary
+	cut := 0
+	for i := range summary {
+		if i > maxLength {
+			break
+		}
+		cut = i
+	}
+	return summary[:cut]
+}
+
+// Pipeline runs message content through a sequence of checks
+type Pipeline struct {
+	action Action
+	checks []Check
+}
+
+// NewPipeline creates a pipeline applying action to content flagged by any of the checks
+func NewPipeline(action Action, checks ...Check) *Pipeline {
+	return &Pipeline{
+		action: action,
+		checks: checks,
+	}
+}
+
+// ForGroup creates the pipeline configured in a group's settings
+func ForGroup(group *models.MessageGroup) (*Pipeline, error) {
+	action, err := ParseAction(group.GetModerationAction())
+	if err != nil {
+		return nil, err
+	}
+
+	regexCheck, err := NewRegexCheck(group.GetBannedPatterns())
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPipeline(action, NewBannedWordsCheck(group.GetBannedWords()), regexCheck), nil
+}
+
+// Run inspects content with every check and applies the pipeline action
+func (p *Pipeline) Run(content string) Result {
+	var matches []Match
+	for _, check := range p.checks {
+		matches = append(matches, check.Inspect(content)...)
+	}
+
+	if len(matches) == 0 {
+		return Result{Action: ActionAllow, Content: content}
+	}
+
+	result := Result{
+		Action:  p.action,
+		Content: content,
+		Matches: matches,
+	}
+
+	if p.action == ActionMask {
+		result.Content = mask(content, matches)
+	}
+
+	return result
+}
+
+// mask replaces the flagged spans of content with asterisks, keeping whitespace
+func mask(content string, matches []Match) string {
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Start < matches[j].Start
+	})
+
+	var b strings.Builder
+	b.Grow(len(content))
+
+	position := 0
+	for _, match := range matches {
+		if match.End <= position {
+			continue
+		}
+		if match.Start > position {
+			b.WriteString(content[position:match.Start])
+		} else {
+			match.Start = position
+		}
+
+		for _, r := range content[match.Start:match.End] {
+			if r == ' ' || r == '\t' || r == '\n' {
+				b.WriteRune(r)
+			} else {
+				b.WriteByte('*')
+			}
+		}
+		position = match.End
+	}
+	b.WriteString(content[position:])
+
+	return b.String()
+}
+
+// BannedWordsCheck flags banned words and phrases, ignoring case, accents and leetspeak
+type BannedWordsCheck struct {
+	words [][]rune
+}
+
+// NewBannedWordsCheck creates a banned words check
+func NewBannedWordsCheck(words []string) *BannedWordsCheck {
+	check := &BannedWordsCheck{}
+	for _, word := range words {
+		normalized := normalize(strings.TrimSpace(word))
+		if len(normalized) > 0 {
+			check.words = append(check.words, normalized)
+		}
+	}
+	return check
+}
+
+// Name returns the name of the check
+func (c *BannedWordsCheck) Name() string {
+	return "banned_words"
+}
+
+// Inspect reports every whole-word occurrence of a banned word in content
+func (c *BannedWordsCheck) Inspect(content string) []Match {
+	if len(c.words) == 0 {
+		return nil
+	}
+
+	text := normalize(content)
+
+	// Byte offset of every rune, plus the end of the content
+	offsets := make([]int, 0, len(text)+1)
+	for offset := range content {
+		offsets = append(offsets, offset)
+	}
+	offsets = append(offsets, len(content))
+
+	var matches []Match
+	for _, word := range c.words {
+		for start := 0; start+len(word) <= len(text); start++ {
+			end := start + len(word)
+			if !equalRunes(text[start:end], word) {
+				continue
+			}
+
+			// Only match whole words so "cuscuz" does not flag "cu"
+			if start > 0 && isWordRune(text[start-1]) {
+				continue
+			}
+			if end < len(text) && isWordRune(text[end]) {
+				continue
+			}
+
+			matches = append(matches, Match{
+				Check:  c.Name(),
+				Reason: "banned word: " + string(word),
+				Start:  offsets[start],
+				End:    offsets[end],
+			})
+		}
+	}
+
+	return matches
+}
+
+// RegexCheck flags content matching any of a set of regular expressions
+type RegexCheck struct {
+	patterns []*regexp.Regexp
+}
+
+// NewRegexCheck creates a regex check, patterns are matched case-insensitively
+func NewRegexCheck(patterns []string) (*RegexCheck, error) {
+	check := &RegexCheck{}
+	for _, pattern := range patterns {
+		if strings.TrimSpace(pattern) == "" {
+			continue
+		}
+
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid banned pattern %q: %w", pattern, err)
+		}
+		check.patterns = append(check.patterns, re)
+	}
+	return check, nil
+}
+
+// Name returns the name of the check
+func (c *RegexCheck) Name() string {
+	return "regex"
+}
+
+// Inspect reports every match of the patterns in content
+func (c *RegexCheck) Inspect(content string) []Match {
+	var matches []Match
+	for _, re := range c.patterns {
+		for _, loc := range re.FindAllStringIndex(content, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+			matches = append(matches, Match{
+				Check:  c.Name(),
+				Reason: "banned pattern: " + strings.TrimPrefix(re.String(), "(?i)"),
+				Start:  loc[0],
+				End:    loc[1],
+			})
+		}
+	}
+	return matches
+}
+
+// ValidateSettings checks the moderation settings of a group before they are saved
+func ValidateSettings(settings map[string]interface{}) error {
+	if value, ok := settings["moderationAction"]; ok {
+		action, _ := value.(string)
+		if _, err := ParseAction(action); err != nil {
+			return err
+		}
+	}
+
+	if value, ok := settings["bannedPatterns"]; ok {
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("bannedPatterns must be a list of strings")
+		}
+
+		patterns := make([]string, 0, len(items))
+		for _, item := range items {
+			pattern, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("bannedPatterns must be a list of strings")
+			}
+			patterns = append(patterns, pattern)
+		}
+
+		if _, err := NewRegexCheck(patterns); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// equalRunes reports whether two rune slices are equal
+func equalRunes(a, b []rune) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
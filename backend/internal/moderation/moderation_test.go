@@ -0,0 +1,173 @@
+package moderation
+
+import (
+	"testing"
+)
+
+func TestBannedWordsCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		words   []string
+		content string
+		flagged bool
+	}{
+		{"exact word", []string{"otário"}, "seu otário", true},
+		{"accent in content only", []string{"otario"}, "seu otário", true},
+		{"accent in banned word only", []string{"otário"}, "seu otario", true},
+		{"cedilla and tilde", []string{"cuzão"}, "que cuzao", true},
+		{"upper case", []string{"porra"}, "PORRA, que dia", true},
+		{"mixed case and accent", []string{"otário"}, "OtÁrIo", true},
+		{"leetspeak", []string{"porra"}, "que p0rr4 é essa", true},
+		{"leetspeak symbols", []string{"besta"}, "b3$t@", true},
+		{"phrase", []string{"vai se ferrar"}, "olha, vai se ferrar", true},
+		{"punctuation around word", []string{"porra"}, "(porra!)", true},
+		{"word inside cuscuz", []string{"cu"}, "adoro cuscuz", false},
+		{"word inside documento", []string{"cu"}, "mandei o documento", false},
+		{"word inside acusação", []string{"cu"}, "a acusação foi retirada", false},
+		{"word inside computador", []string{"puta"}, "meu computador quebrou", false},
+		{"plural is another word", []string{"merda"}, "merdas acontecem", false},
+		{"clean content", []string{"porra"}, "bom dia, tudo bem?", false},
+		{"no banned words", nil, "porra", false},
+		{"blank banned word ignored", []string{"  "}, "qualquer coisa", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches := NewBannedWordsCheck(tt.words).Inspect(tt.content)
+			if flagged := len(matches) > 0; flagged != tt.flagged {
+				t.Errorf("Inspect(%q) flagged = %v, want %v (matches: %v)", tt.content, flagged, tt.flagged, matches)
+			}
+		})
+	}
+}
+
+func TestBannedWordsCheckSpans(t *testing.T) {
+	content := "é uma PÓRRA mesmo"
+	matches := NewBannedWordsCheck([]string{"porra"}).Inspect(content)
+	if len(matches) != 1 {
+		t.Fatalf("got %d matches, want 1", len(matches))
+	}
+
+	if got := content[matches[0].Start:matches[0].End]; got != "PÓRRA" {
+		t.Errorf("match span = %q, want %q", got, "PÓRRA")
+	}
+}
+
+func TestRegexCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		content  string
+		flagged  bool
+	}{
+		{"phone number", []string{`\d{4,5}-?\d{4}`}, "me liga 99999-8888", true},
+		{"case insensitive", []string{`whats?app`}, "chama no WhatsApp", true},
+		{"accented pattern", []string{`endereço`}, "qual o seu ENDEREÇO?", true},
+		{"no match", []string{`\d{4,5}-?\d{4}`}, "me liga amanhã", false},
+		{"blank pattern ignored", []string{""}, "qualquer coisa", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check, err := NewRegexCheck(tt.patterns)
+			if err != nil {
+				t.Fatalf("NewRegexCheck: %v", err)
+			}
+
+			matches := check.Inspect(tt.content)
+			if flagged := len(matches) > 0; flagged != tt.flagged {
+				t.Errorf("Inspect(%q) flagged = %v, want %v", tt.content, flagged, tt.flagged)
+			}
+		})
+	}
+}
+
+func TestNewRegexCheckInvalidPattern(t *testing.T) {
+	if _, err := NewRegexCheck([]string{"(abc"}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestPipelineActions(t *testing.T) {
+	regexCheck, err := NewRegexCheck([]string{`\d{4,5}-\d{4}`})
+	if err != nil {
+		t.Fatalf("NewRegexCheck: %v", err)
+	}
+	wordsCheck := NewBannedWordsCheck([]string{"porra", "otário"})
+
+	tests := []struct {
+		name        string
+		action      Action
+		content     string
+		wantAction  Action
+		wantContent string
+	}{
+		{"clean content is allowed", ActionReject, "bom dia, tudo bem?", ActionAllow, "bom dia, tudo bem?"},
+		{"reject", ActionReject, "que porra", ActionReject, "que porra"},
+		{"quarantine", ActionQuarantine, "seu otario", ActionQuarantine, "seu otario"},
+		{"mask banned word", ActionMask, "que p0rr4 é essa", ActionMask, "que ***** é essa"},
+		{"mask accented word", ActionMask, "seu OTÁRIO!", ActionMask, "seu ******!"},
+		{"mask regex match", ActionMask, "liga 99999-8888 agora", ActionMask, "liga ********** agora"},
+		{"mask several matches", ActionMask, "porra, otário", ActionMask, "*****, ******"},
+		{"mask keeps whitespace", ActionMask, "liga 9999-8888", ActionMask, "liga *********"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := NewPipeline(tt.action, wordsCheck, regexCheck).Run(tt.content)
+			if result.Action != tt.wantAction {
+				t.Errorf("Action = %q, want %q", result.Action, tt.wantAction)
+			}
+			if result.Content != tt.wantContent {
+				t.Errorf("Content = %q, want %q", result.Content, tt.wantContent)
+			}
+			if tt.wantAction != ActionAllow && len(result.Reasons()) == 0 {
+				t.Error("expected the flagged content to have reasons")
+			}
+		})
+	}
+}
+
+func TestParseAction(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Action
+		wantErr bool
+	}{
+		{"", ActionReject, false},
+		{"reject", ActionReject, false},
+		{"mask", ActionMask, false},
+		{"quarantine", ActionQuarantine, false},
+		{"allow", "", true},
+		{"apagar", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseAction(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAction(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseAction(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResultSummary(t *testing.T) {
+	result := Result{Matches: []Match{
+		{Reason: "banned word: otário"},
+		{Reason: "banned word: otário"},
+		{Reason: "banned word: porra"},
+	}}
+
+	if got, want := result.Summary(100), "banned word: otário; banned word: porra"; got != want {
+		t.Errorf("Summary = %q, want %q", got, want)
+	}
+
+	// Cutting inside "á" must not split the rune
+	if got, want := result.Summary(16), "banned word: ot"; got != want {
+		t.Errorf("Summary = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,50 @@
+package moderation
+
+import (
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// leetspeak maps common character substitutions to the letters they stand for
+var leetspeak = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'3': 'e',
+	'4': 'a',
+	'5': 's',
+	'7': 't',
+	'@': 'a',
+	'$': 's',
+}
+
+// normalizeRune folds a rune to its lowercase, unaccented, de-leeted form
+func normalizeRune(r rune) rune {
+	if replacement, ok := leetspeak[r]; ok {
+		return replacement
+	}
+
+	// Decompose accented letters (e.g. "ã" into "a" + "~") and keep the base letter
+	for _, decomposed := range norm.NFD.String(string(r)) {
+		if !unicode.Is(unicode.Mn, decomposed) {
+			r = decomposed
+			break
+		}
+	}
+
+	return unicode.ToLower(r)
+}
+
+// normalize folds every rune of s, the result has the same number of runes as s
+func normalize(s string) []rune {
+	runes := []rune(s)
+	for i, r := range runes {
+		runes[i] = normalizeRune(r)
+	}
+	return runes
+}
+
+// isWordRune reports whether r can be part of a word
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
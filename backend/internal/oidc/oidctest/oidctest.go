@@ -0,0 +1,227 @@
+// Package oidctest serves a fake OpenID Connect provider for tests
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ralfferreira/papo-reto/internal/config"
+)
+
+const (
+	clientID     = "papo-reto"
+	clientSecret = "segredo"
+	redirectURL  = "http://localhost:3000/auth/oidc/test/callback"
+	keyID        = "test-key"
+)
+
+// Login is the user who signs in at the provider
+type Login struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+
+	// Nonce replaces the nonce of the authorization request when set
+	Nonce string
+
+	// Forged signs the ID token with a key the provider does not publish
+	Forged bool
+}
+
+// grant is an authorization code waiting to be exchanged
+type grant struct {
+	codeChallenge string
+	idToken       string
+}
+
+// Provider is a provider serving discovery, JWKS and token endpoints.
+// The token endpoint only exchanges codes with the PKCE verifier of their authorization request.
+type Provider struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	forgedKey *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]*grant
+}
+
+// NewProvider starts a provider, stopped when the test ends
+func NewProvider(t *testing.T) *Provider {
+	t.Helper()
+
+	p := &Provider{
+		key:       generateKey(t),
+		forgedKey: generateKey(t),
+		grants:    make(map[string]*grant),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/token", p.token)
+
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+// Config returns the configuration of a client of the provider
+func (p *Provider) Config(name string) config.OIDCProviderConfig {
+	return config.OIDCProviderConfig{
+		Name:         name,
+		IssuerURL:    p.server.URL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       []string{"openid", "email", "profile"},
+		RedirectURL:  redirectURL,
+	}
+}
+
+// Authorize plays the user signing in at the authorization URL and returns
+// the code the provider redirects back with
+func (p *Provider) Authorize(t *testing.T, authorizationURL string, login Login) string {
+	t.Helper()
+
+	u, err := url.Parse(authorizationURL)
+	if err != nil {
+		t.Fatalf("invalid authorization URL: %v", err)
+	}
+	query := u.Query()
+
+	if query.Get("client_id") != clientID || query.Get("redirect_uri") != redirectURL {
+		t.Fatalf("authorization URL has the wrong client: %s", authorizationURL)
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization URL has no S256 PKCE challenge: %s", authorizationURL)
+	}
+
+	nonce := query.Get("nonce")
+	if login.Nonce != "" {
+		nonce = login.Nonce
+	}
+
+	key := p.key
+	if login.Forged {
+		key = p.forgedKey
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            p.server.URL,
+		"aud":            clientID,
+		"sub":            login.Subject,
+		"email":          login.Email,
+		"email_verified": login.EmailVerified,
+		"name":           login.Name,
+		"nonce":          nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = keyID
+
+	idToken, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign ID token: %v", err)
+	}
+
+	code := randomString()
+
+	p.mu.Lock()
+	p.grants[code] = &grant{codeChallenge: query.Get("code_challenge"), idToken: idToken}
+	p.mu.Unlock()
+
+	return code
+}
+
+// discovery serves the discovery document
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 p.server.URL,
+		"authorization_endpoint": p.server.URL + "/authorize",
+		"token_endpoint":         p.server.URL + "/token",
+		"jwks_uri":               p.server.URL + "/jwks",
+	})
+}
+
+// jwks serves the public signing key
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+// token exchanges a code for its ID token, each code once and only with its PKCE verifier
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != clientID || secret != clientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	g, found := p.grants[r.PostForm.Get("code")]
+	delete(p.grants, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !found || base64.RawURLEncoding.EncodeToString(sum[:]) != g.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"id_token":     g.idToken,
+	})
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// generateKey generates an RSA signing key
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return key
+}
+
+// randomString returns a random URL-safe string
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,217 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ralfferreira/papo-reto/internal/config"
+)
+
+// idTokenLeeway is the clock skew tolerated when checking ID token times
+const idTokenLeeway = time.Minute
+
+// signingMethods are the ID token algorithms accepted, symmetric ones are never accepted
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// metadata is the part of a provider's discovery document used by the login flow
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDTokenClaims represents the claims of an ID token used to sign a user in
+type IDTokenClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Nonce         string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// Provider is an OpenID Connect provider users can sign in with.
+// Its discovery document is fetched on first use and kept for the life of the process.
+type Provider struct {
+	config config.OIDCProviderConfig
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *metadata
+	keys     *keySet
+}
+
+// NewProvider creates a provider from its configuration
+func NewProvider(cfg config.OIDCProviderConfig) *Provider {
+	return &Provider{
+		config: cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name returns the name the provider is configured under
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// AuthCodeURL returns the URL the user is sent to to sign in with the provider
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	md, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {CodeChallenge(codeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(md.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return md.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange trades an authorization code for the ID token of the user who signed in
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	md, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token exchange failed: %s %s", body.Error, body.ErrorDescription)
+	}
+
+	if body.IDToken == "" {
+		return "", errors.New("token response has no ID token")
+	}
+
+	return body.IDToken, nil
+}
+
+// VerifyIDToken checks the signature, issuer, audience, lifetime and nonce of an ID token
+func (p *Provider) VerifyIDToken(ctx context.Context, rawToken, nonce string) (*IDTokenClaims, error) {
+	md, keys, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &IDTokenClaims{}
+	_, err = jwt.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return keys.key(ctx, kid)
+	},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(md.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(idTokenLeeway),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("ID token has no subject")
+	}
+
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, errors.New("ID token nonce mismatch")
+	}
+
+	return claims, nil
+}
+
+// discover fetches the provider's discovery document once, a failed fetch is retried on the next call
+func (p *Provider) discover(ctx context.Context) (*metadata, *keySet, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, p.keys, nil
+	}
+
+	issuer := strings.TrimSuffix(p.config.IssuerURL, "/")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("failed to fetch discovery document: %s", resp.Status)
+	}
+
+	md := &metadata{}
+	if err := json.NewDecoder(resp.Body).Decode(md); err != nil {
+		return nil, nil, err
+	}
+
+	// The issuer must match the configured one, or ID tokens could be accepted from another issuer
+	if strings.TrimSuffix(md.Issuer, "/") != issuer {
+		return nil, nil, fmt.Errorf("discovery issuer %q does not match %q", md.Issuer, p.config.IssuerURL)
+	}
+
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, nil, errors.New("discovery document is missing endpoints")
+	}
+
+	p.metadata = md
+	p.keys = newKeySet(md.JWKSURI, p.client)
+
+	return p.metadata, p.keys, nil
+}
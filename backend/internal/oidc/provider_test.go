@@ -0,0 +1,80 @@
+package oidc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ralfferreira/papo-reto/internal/oidc/oidctest"
+)
+
+// signIn runs the authorization code flow up to the ID token, as the user described by login
+func signIn(t *testing.T, mock *oidctest.Provider, provider *Provider, login oidctest.Login, codeVerifier string) (string, error) {
+	t.Helper()
+
+	ctx := context.Background()
+	authorizationURL, err := provider.AuthCodeURL(ctx, "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+
+	code := mock.Authorize(t, authorizationURL, login)
+	return provider.Exchange(ctx, code, codeVerifier)
+}
+
+func TestProviderLoginWithPKCE(t *testing.T) {
+	mock := oidctest.NewProvider(t)
+	provider := NewProvider(mock.Config("test"))
+
+	idToken, err := signIn(t, mock, provider, oidctest.Login{Subject: "123", Email: "ana@example.com", EmailVerified: true, Name: "Ana"}, "verifier")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	claims, err := provider.VerifyIDToken(context.Background(), idToken, "nonce")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if claims.Subject != "123" || claims.Email != "ana@example.com" || !claims.EmailVerified || claims.Name != "Ana" {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+}
+
+func TestProviderExchangeRequiresCodeVerifier(t *testing.T) {
+	mock := oidctest.NewProvider(t)
+	provider := NewProvider(mock.Config("test"))
+
+	if _, err := signIn(t, mock, provider, oidctest.Login{Subject: "123"}, "another-verifier"); err == nil {
+		t.Fatal("code was exchanged with the wrong PKCE verifier")
+	}
+}
+
+func TestProviderVerifyIDToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		login   oidctest.Login
+		nonce   string
+		wantErr bool
+	}{
+		{"valid", oidctest.Login{Subject: "123"}, "nonce", false},
+		{"nonce mismatch", oidctest.Login{Subject: "123", Nonce: "another-nonce"}, "nonce", true},
+		{"empty nonce", oidctest.Login{Subject: "123"}, "", true},
+		{"bad signature", oidctest.Login{Subject: "123", Forged: true}, "nonce", true},
+		{"no subject", oidctest.Login{}, "nonce", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := oidctest.NewProvider(t)
+			provider := NewProvider(mock.Config("test"))
+
+			idToken, err := signIn(t, mock, provider, tt.login, "verifier")
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+
+			if _, err := provider.VerifyIDToken(context.Background(), idToken, tt.nonce); (err != nil) != tt.wantErr {
+				t.Errorf("VerifyIDToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrStateNotFound is returned when a login state is unknown, expired or already used
+var ErrStateNotFound = errors.New("login state not found")
+
+// LoginState is what must be remembered between sending a user to a provider and their return
+type LoginState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"codeVerifier"`
+}
+
+// StateStore keeps login states in Redis until the user comes back from the provider
+type StateStore struct {
+	redis *redis.Client
+	ttl   time.Duration
+}
+
+// NewStateStore creates a new state store keeping states for ttl
+func NewStateStore(rdb *redis.Client, ttl time.Duration) *StateStore {
+	return &StateStore{
+		redis: rdb,
+		ttl:   ttl,
+	}
+}
+
+// Save stores a login state under the state parameter sent to the provider
+func (s *StateStore) Save(ctx context.Context, state string, loginState *LoginState) error {
+	value, err := json.Marshal(loginState)
+	if err != nil {
+		return err
+	}
+	return s.redis.Set(ctx, stateKey(state), value, s.ttl).Err()
+}
+
+// Take returns and deletes a login state, so each state is accepted only once
+func (s *StateStore) Take(ctx context.Context, state string) (*LoginState, error) {
+	value, err := s.redis.GetDel(ctx, stateKey(state)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrStateNotFound
+		}
+		return nil, err
+	}
+
+	var loginState LoginState
+	if err := json.Unmarshal(value, &loginState); err != nil {
+		return nil, err
+	}
+	return &loginState, nil
+}
+
+// stateKey returns the Redis key of a login state
+func stateKey(state string) string {
+	return "papo-reto:oidc:states:" + state
+}
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryLimiter is an in-process sliding window limiter, meant for tests and single instance setups
+type MemoryLimiter struct {
+	mu       sync.Mutex
+	requests map[string][]time.Time
+	now      func() time.Time
+}
+
+// NewMemoryLimiter creates a new in-memory limiter
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		requests: make(map[string][]time.Time),
+		now:      time.Now,
+	}
+}
+
+// SetClock replaces the clock used by the limiter
+func (l *MemoryLimiter) SetClock(now func() time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.now = now
+}
+
+// Allow checks and records a request for key
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	cutoff := now.Add(-limit.Window)
+
+	// Drop requests that left the window
+	requests := l.requests[key]
+	kept := requests[:0]
+	for _, requestTime := range requests {
+		if requestTime.After(cutoff) {
+			kept = append(kept, requestTime)
+		}
+	}
+
+	allowed := len(kept) < limit.Requests
+	if allowed {
+		kept = append(kept, now)
+	}
+
+	if len(kept) == 0 {
+		delete(l.requests, key)
+		return newResult(allowed, limit, 0, now, now), nil
+	}
+	l.requests[key] = kept
+
+	return newResult(allowed, limit, len(kept), kept[0], now), nil
+}
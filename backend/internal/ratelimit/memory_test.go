@@ -0,0 +1,155 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock the tests move by hand
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestLimiter() (*MemoryLimiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	limiter := NewMemoryLimiter()
+	limiter.SetClock(clock.Now)
+	return limiter, clock
+}
+
+func TestMemoryLimiterAllowsUpToLimit(t *testing.T) {
+	limiter, clock := newTestLimiter()
+	limit := Limit{Requests: 3, Window: time.Minute}
+
+	for i := 0; i < 3; i++ {
+		result, err := limiter.Allow(context.Background(), "ip:1.2.3.4", limit)
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		if !result.Allowed {
+			t.Fatalf("request %d was rejected", i+1)
+		}
+		if want := 2 - i; result.Remaining != want {
+			t.Errorf("request %d: Remaining = %d, want %d", i+1, result.Remaining, want)
+		}
+		clock.Advance(time.Second)
+	}
+
+	result, err := limiter.Allow(context.Background(), "ip:1.2.3.4", limit)
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	if result.Allowed {
+		t.Fatal("request over the limit was allowed")
+	}
+	if result.Remaining != 0 {
+		t.Errorf("Remaining = %d, want 0", result.Remaining)
+	}
+	if result.Limit != 3 {
+		t.Errorf("Limit = %d, want 3", result.Limit)
+	}
+
+	// The oldest request was 3 seconds ago, so it leaves the window in 57 seconds
+	if want := 57 * time.Second; result.RetryAfter != want {
+		t.Errorf("RetryAfter = %v, want %v", result.RetryAfter, want)
+	}
+}
+
+func TestMemoryLimiterSlidingWindow(t *testing.T) {
+	limiter, clock := newTestLimiter()
+	limit := Limit{Requests: 2, Window: time.Minute}
+	ctx := context.Background()
+
+	limiter.Allow(ctx, "key", limit)
+	clock.Advance(30 * time.Second)
+	limiter.Allow(ctx, "key", limit)
+
+	if result, _ := limiter.Allow(ctx, "key", limit); result.Allowed {
+		t.Fatal("request over the limit was allowed")
+	}
+
+	// Only the first request has left the window
+	clock.Advance(31 * time.Second)
+	result, _ := limiter.Allow(ctx, "key", limit)
+	if !result.Allowed {
+		t.Fatal("request was rejected after the oldest one left the window")
+	}
+	if result.Remaining != 0 {
+		t.Errorf("Remaining = %d, want 0", result.Remaining)
+	}
+
+	if result, _ := limiter.Allow(ctx, "key", limit); result.Allowed {
+		t.Fatal("request over the limit was allowed")
+	}
+}
+
+func TestMemoryLimiterRejectedRequestsAreNotCounted(t *testing.T) {
+	limiter, clock := newTestLimiter()
+	limit := Limit{Requests: 1, Window: time.Minute}
+	ctx := context.Background()
+
+	limiter.Allow(ctx, "key", limit)
+
+	// Retrying while limited must not push the reset further away
+	for i := 0; i < 10; i++ {
+		clock.Advance(5 * time.Second)
+		limiter.Allow(ctx, "key", limit)
+	}
+
+	clock.Advance(11 * time.Second)
+	if result, _ := limiter.Allow(ctx, "key", limit); !result.Allowed {
+		t.Fatal("request was rejected after the window passed")
+	}
+}
+
+func TestMemoryLimiterKeysAreIndependent(t *testing.T) {
+	limiter, _ := newTestLimiter()
+	limit := Limit{Requests: 1, Window: time.Minute}
+	ctx := context.Background()
+
+	if result, _ := limiter.Allow(ctx, "group:a", limit); !result.Allowed {
+		t.Fatal("first request for group:a was rejected")
+	}
+	if result, _ := limiter.Allow(ctx, "group:b", limit); !result.Allowed {
+		t.Fatal("first request for group:b was rejected")
+	}
+	if result, _ := limiter.Allow(ctx, "group:a", limit); result.Allowed {
+		t.Fatal("second request for group:a was allowed")
+	}
+}
+
+func TestValidateSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		wantErr  bool
+	}{
+		{"no rate limit", map[string]interface{}{}, false},
+		{"valid overrides", map[string]interface{}{"rateLimit": map[string]interface{}{"perSender": 10.0, "perGroup": 500.0, "windowSeconds": 120.0}}, false},
+		{"bounds", map[string]interface{}{"rateLimit": map[string]interface{}{"perSender": 100.0, "perGroup": 10000.0, "windowSeconds": 10.0}}, false},
+		{"not an object", map[string]interface{}{"rateLimit": "off"}, true},
+		{"zero", map[string]interface{}{"rateLimit": map[string]interface{}{"perSender": 0.0}}, true},
+		{"fraction", map[string]interface{}{"rateLimit": map[string]interface{}{"perGroup": 1.5}}, true},
+		{"per sender over cap", map[string]interface{}{"rateLimit": map[string]interface{}{"perSender": 101.0}}, true},
+		{"per group over cap", map[string]interface{}{"rateLimit": map[string]interface{}{"perGroup": 1000000.0}}, true},
+		{"window too short", map[string]interface{}{"rateLimit": map[string]interface{}{"windowSeconds": 1.0}}, true},
+		{"window too long", map[string]interface{}{"rateLimit": map[string]interface{}{"windowSeconds": 86401.0}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateSettings(tt.settings); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSettings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
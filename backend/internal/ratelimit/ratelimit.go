@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Bounds of the limits a group owner can set, so an override can tune throttling but not turn it off
+const (
+	MaxPerSender     = 100
+	MaxPerGroup      = 10000
+	MinWindowSeconds = 10
+	MaxWindowSeconds = 86400
+)
+
+// Limit is the number of requests allowed in a sliding window
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// Result is the outcome of a rate limit check
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAfter time.Duration
+	RetryAfter time.Duration
+}
+
+// Limiter checks and records requests against a limit
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// newResult builds a result from the state of a sliding window
+func newResult(allowed bool, limit Limit, count int, oldest, now time.Time) Result {
+	remaining := limit.Requests - count
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	resetAfter := oldest.Add(limit.Window).Sub(now)
+	if resetAfter < 0 {
+		resetAfter = 0
+	}
+
+	result := Result{
+		Allowed:    allowed,
+		Limit:      limit.Requests,
+		Remaining:  remaining,
+		ResetAfter: resetAfter,
+	}
+	if !allowed {
+		result.RetryAfter = resetAfter
+	}
+
+	return result
+}
+
+// ValidateSettings checks the rate limit settings of a group before they are saved
+func ValidateSettings(settings map[string]interface{}) error {
+	value, ok := settings["rateLimit"]
+	if !ok || value == nil {
+		return nil
+	}
+
+	rateLimit, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("rateLimit must be an object")
+	}
+
+	bounds := []struct {
+		field    string
+		min, max int
+	}{
+		{"perSender", 1, MaxPerSender},
+		{"perGroup", 1, MaxPerGroup},
+		{"windowSeconds", MinWindowSeconds, MaxWindowSeconds},
+	}
+
+	for _, bound := range bounds {
+		raw, ok := rateLimit[bound.field]
+		if !ok {
+			continue
+		}
+
+		number, ok := raw.(float64)
+		if !ok || number != float64(int(number)) || number < float64(bound.min) || number > float64(bound.max) {
+			return fmt.Errorf("rateLimit.%s must be an integer between %d and %d", bound.field, bound.min, bound.max)
+		}
+	}
+
+	return nil
+}
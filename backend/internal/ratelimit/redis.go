@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// slidingWindowScript records a request in a sorted set of request timestamps
+// when the window still has room. It returns whether the request was allowed,
+// the number of requests in the window and the timestamp of the oldest one.
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+
+local count = redis.call('ZCARD', key)
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	redis.call('PEXPIRE', key, window)
+	count = count + 1
+	allowed = 1
+end
+
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+local oldestScore = now
+if oldest[2] then
+	oldestScore = tonumber(oldest[2])
+end
+
+return {allowed, count, oldestScore}
+`)
+
+// RedisLimiter is a sliding window limiter shared by every API replica through Redis
+type RedisLimiter struct {
+	redis *redis.Client
+}
+
+// NewRedisLimiter creates a new Redis limiter
+func NewRedisLimiter(rdb *redis.Client) *RedisLimiter {
+	return &RedisLimiter{
+		redis: rdb,
+	}
+}
+
+// Allow checks and records a request for key
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+
+	values, err := slidingWindowScript.Run(ctx, l.redis, []string{"papo-reto:ratelimit:" + key},
+		now.UnixMilli(), limit.Window.Milliseconds(), limit.Requests, uuid.New().String()).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	return newResult(values[0] == 1, limit, int(values[1]), time.UnixMilli(values[2]), now), nil
+}
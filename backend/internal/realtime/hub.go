@@ -0,0 +1,346 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// Event types delivered to inbox subscribers
+const (
+	EventMessageCreated  = "message.created"
+	EventMessageUpdated  = "message.updated"
+	EventMessageDeleted  = "message.deleted"
+	EventReplyCreated    = "reply.created"
+	EventGroupArchived   = "group.archived"
+	EventGroupUnarchived = "group.unarchived"
+)
+
+// eventsChannel is the Redis channel shared by every API replica
+const eventsChannel = "papo-reto:events"
+
+const (
+	// replayBufferSize is the approximate number of events kept per group for resuming streams
+	replayBufferSize = 200
+
+	// replayBufferTTL is how long the replay buffer of an idle group is kept
+	replayBufferTTL = 24 * time.Hour
+)
+
+// subscriptionBufferSize is the number of events buffered per subscriber
+const subscriptionBufferSize = 32
+
+// ErrHubClosed is returned when subscribing to a hub that is shutting down
+var ErrHubClosed = errors.New("realtime hub is closed")
+
+// Event represents an inbox event for a message group
+type Event struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	GroupID   uuid.UUID       `json:"groupId"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// Hub fans out inbox events to local subscribers through Redis pub/sub
+type Hub struct {
+	redis *redis.Client
+
+	mu            sync.RWMutex
+	subscribers   map[uuid.UUID]map[*Subscription]struct{}
+	subscriptions map[*Subscription]struct{}
+	closed        bool
+	wg            sync.WaitGroup
+
+	pubsub *redis.PubSub
+	done   chan struct{}
+}
+
+// NewHub creates a new realtime hub
+func NewHub(rdb *redis.Client) *Hub {
+	return &Hub{
+		redis:         rdb,
+		subscribers:   make(map[uuid.UUID]map[*Subscription]struct{}),
+		subscriptions: make(map[*Subscription]struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// Start subscribes to the Redis events channel and dispatches events to local subscribers
+func (h *Hub) Start() {
+	h.pubsub = h.redis.Subscribe(context.Background(), eventsChannel)
+
+	go func() {
+		defer close(h.done)
+
+		for msg := range h.pubsub.Channel() {
+			var event Event
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				log.Printf("Failed to decode realtime event: %v", err)
+				continue
+			}
+			h.dispatch(event)
+		}
+	}()
+}
+
+// Publish publishes an event for a group to every API replica
+func (h *Hub) Publish(ctx context.Context, eventType string, groupID uuid.UUID, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	event := Event{
+		Type:      eventType,
+		GroupID:   groupID,
+		Data:      payload,
+		CreatedAt: time.Now(),
+	}
+
+	// Append the event to the replay buffer of the group, the stream ID becomes the event ID
+	key := replayBufferKey(groupID)
+	id, err := h.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream:       key,
+		MaxLenApprox: replayBufferSize,
+		Values:       map[string]interface{}{"data": string(payload), "type": eventType, "createdAt": event.CreatedAt.Format(time.RFC3339Nano)},
+	}).Result()
+	if err != nil {
+		return err
+	}
+	event.ID = id
+
+	if err := h.redis.Expire(ctx, key, replayBufferTTL).Err(); err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return h.redis.Publish(ctx, eventsChannel, encoded).Err()
+}
+
+// Replay returns the buffered events of a group published after lastEventID
+func (h *Hub) Replay(ctx context.Context, groupID uuid.UUID, lastEventID string) ([]Event, error) {
+	if _, _, err := parseEventID(lastEventID); err != nil {
+		return nil, err
+	}
+
+	entries, err := h.redis.XRange(ctx, replayBufferKey(groupID), lastEventID, "+").Result()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]Event, 0, len(entries))
+	for _, entry := range entries {
+		// XRANGE is inclusive, skip the event the client has already seen
+		if entry.ID == lastEventID {
+			continue
+		}
+
+		event := Event{
+			ID:      entry.ID,
+			GroupID: groupID,
+		}
+		if eventType, ok := entry.Values["type"].(string); ok {
+			event.Type = eventType
+		}
+		if payload, ok := entry.Values["data"].(string); ok {
+			event.Data = json.RawMessage(payload)
+		}
+		if createdAt, ok := entry.Values["createdAt"].(string); ok {
+			event.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// Subscribe registers a subscription for the events of the given groups
+func (h *Hub) Subscribe(groupIDs []uuid.UUID) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, ErrHubClosed
+	}
+
+	sub := &Subscription{
+		hub:    h,
+		groups: groupIDs,
+		events: make(chan Event, subscriptionBufferSize),
+		done:   make(chan struct{}),
+	}
+
+	for _, groupID := range groupIDs {
+		if h.subscribers[groupID] == nil {
+			h.subscribers[groupID] = make(map[*Subscription]struct{})
+		}
+		h.subscribers[groupID][sub] = struct{}{}
+	}
+
+	// Kept apart from the groups so subscriptions without any group are signalled too
+	h.subscriptions[sub] = struct{}{}
+	h.wg.Add(1)
+	return sub, nil
+}
+
+// Shutdown signals every subscription to finish and waits for them to be closed
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+
+	subs := make([]*Subscription, 0, len(h.subscriptions))
+	for sub := range h.subscriptions {
+		subs = append(subs, sub)
+	}
+	h.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.signalDone()
+	}
+
+	// Wait for the subscribers to drain their connections
+	drained := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if h.pubsub != nil {
+		if err := h.pubsub.Close(); err != nil {
+			return err
+		}
+		<-h.done
+	}
+
+	return nil
+}
+
+// IsEventAfter reports whether the event ID a was published after the event ID b
+func IsEventAfter(a, b string) bool {
+	aMillis, aSeq, errA := parseEventID(a)
+	bMillis, bSeq, errB := parseEventID(b)
+	if errA != nil || errB != nil {
+		return true
+	}
+
+	if aMillis != bMillis {
+		return aMillis > bMillis
+	}
+	return aSeq > bSeq
+}
+
+// parseEventID parses a Redis stream ID in the "<milliseconds>-<sequence>" format
+func parseEventID(id string) (uint64, uint64, error) {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid event ID: %q", id)
+	}
+
+	millis, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid event ID: %q", id)
+	}
+
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid event ID: %q", id)
+	}
+
+	return millis, seq, nil
+}
+
+// replayBufferKey returns the Redis key of the replay buffer of a group
+func replayBufferKey(groupID uuid.UUID) string {
+	return "papo-reto:groups:" + groupID.String() + ":events"
+}
+
+// dispatch delivers an event to the local subscribers of its group
+func (h *Hub) dispatch(event Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subscribers[event.GroupID] {
+		select {
+		case sub.events <- event:
+		default:
+			// Slow subscriber, drop the event rather than blocking every other socket
+			log.Printf("Dropping %s event for slow subscriber of group %s", event.Type, event.GroupID)
+		}
+	}
+}
+
+// unsubscribe removes a subscription from the hub
+func (h *Hub) unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, groupID := range sub.groups {
+		delete(h.subscribers[groupID], sub)
+		if len(h.subscribers[groupID]) == 0 {
+			delete(h.subscribers, groupID)
+		}
+	}
+	delete(h.subscriptions, sub)
+
+	h.wg.Done()
+}
+
+// Subscription receives the events of a set of groups
+type Subscription struct {
+	hub    *Hub
+	groups []uuid.UUID
+	events chan Event
+
+	done      chan struct{}
+	doneOnce  sync.Once
+	closeOnce sync.Once
+}
+
+// Events returns the channel on which events are delivered
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Done returns a channel that is closed when the hub is shutting down
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close unregisters the subscription from the hub
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		s.hub.unsubscribe(s)
+	})
+}
+
+// signalDone notifies the subscriber that it must finish
+func (s *Subscription) signalDone() {
+	s.doneOnce.Do(func() {
+		close(s.done)
+	})
+}
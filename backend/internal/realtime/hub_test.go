@@ -0,0 +1,36 @@
+package realtime
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestShutdownSignalsEverySubscription(t *testing.T) {
+	// Publishing is not needed, the hub is never started
+	hub := NewHub(nil)
+
+	// A user who can see no group still holds a socket open
+	for _, groupIDs := range [][]uuid.UUID{nil, {uuid.New(), uuid.New()}} {
+		sub, err := hub.Subscribe(groupIDs)
+		if err != nil {
+			t.Fatalf("Subscribe: %v", err)
+		}
+		go func() {
+			<-sub.Done()
+			sub.Close()
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := hub.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if _, err := hub.Subscribe(nil); err != ErrHubClosed {
+		t.Errorf("Subscribe() after shutdown error = %v, want %v", err, ErrHubClosed)
+	}
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"gorm.io/gorm"
+)
+
+// APIKeyRepository handles database operations for API keys
+type APIKeyRepository struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyRepository creates a new API key repository
+func NewAPIKeyRepository(db *gorm.DB) *APIKeyRepository {
+	return &APIKeyRepository{
+		db: db,
+	}
+}
+
+// Create creates a new API key
+func (r *APIKeyRepository) Create(key *models.APIKey) error {
+	return r.db.Create(key).Error
+}
+
+// GetByHash gets an API key by the hash of its value
+func (r *APIKeyRepository) GetByHash(hash string) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := r.db.First(&key, "key_hash = ?", hash).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("API key not found")
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GetActiveByUserID gets the API keys of a user that have not been revoked
+func (r *APIKeyRepository) GetActiveByUserID(userID uuid.UUID) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := r.db.Where("user_id = ? AND revoked_at IS NULL", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// CountActiveByUserID counts the API keys of a user that have not been revoked
+func (r *APIKeyRepository) CountActiveByUserID(userID uuid.UUID) (int64, error) {
+	var count int64
+	if err := r.db.Model(&models.APIKey{}).Where("user_id = ? AND revoked_at IS NULL", userID).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Revoke revokes an API key of a user.
+// It reports false if the user has no such key or it was already revoked.
+func (r *APIKeyRepository) Revoke(id, userID uuid.UUID) (bool, error) {
+	result := r.db.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// TouchLastUsed records that an API key was used, unless it was already recorded since threshold.
+// Skipping recent updates keeps busy scripts from writing on every request.
+func (r *APIKeyRepository) TouchLastUsed(id uuid.UUID, usedAt, threshold time.Time) error {
+	return r.db.Model(&models.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, threshold).
+		Update("last_used_at", usedAt).Error
+}
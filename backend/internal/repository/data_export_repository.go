@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DataExportRepository handles database operations for data exports
+type DataExportRepository struct {
+	db *gorm.DB
+}
+
+// NewDataExportRepository creates a new data export repository
+func NewDataExportRepository(db *gorm.DB) *DataExportRepository {
+	return &DataExportRepository{
+		db: db,
+	}
+}
+
+// Create creates a new data export
+func (r *DataExportRepository) Create(export *models.DataExport) error {
+	return r.db.Create(export).Error
+}
+
+// GetByID gets a data export by ID
+func (r *DataExportRepository) GetByID(id uuid.UUID) (*models.DataExport, error) {
+	var export models.DataExport
+	if err := r.db.First(&export, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("data export not found")
+		}
+		return nil, err
+	}
+	return &export, nil
+}
+
+// GetByTokenHash gets a completed data export by the hash of its download token
+func (r *DataExportRepository) GetByTokenHash(hash string) (*models.DataExport, error) {
+	var export models.DataExport
+	if err := r.db.First(&export, "token_hash = ? AND status = ?", hash, models.DataExportStatusCompleted).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("data export not found")
+		}
+		return nil, err
+	}
+	return &export, nil
+}
+
+// HasInProgress checks if a user has a data export waiting for or being built by a worker
+func (r *DataExportRepository) HasInProgress(userID uuid.UUID) (bool, error) {
+	var count int64
+	if err := r.db.Model(&models.DataExport{}).
+		Where("user_id = ? AND status IN ?", userID, []string{models.DataExportStatusPending, models.DataExportStatusRunning}).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// ClaimNext marks the oldest pending export as running on an instance and returns it. Running
+// exports started before staleBefore are claimed again, their worker is assumed to have died.
+// It returns nil if there is nothing to claim.
+func (r *DataExportRepository) ClaimNext(now, staleBefore time.Time, instance string) (*models.DataExport, error) {
+	var export models.DataExport
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Skip exports other instances are claiming
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? OR (status = ? AND started_at < ?)",
+				models.DataExportStatusPending, models.DataExportStatusRunning, staleBefore).
+			Order("created_at ASC").
+			First(&export).Error; err != nil {
+			return err
+		}
+
+		export.Status = models.DataExportStatusRunning
+		export.Instance = instance
+		export.StartedAt = &now
+		export.UpdatedAt = now
+		return tx.Save(&export).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &export, nil
+}
+
+// Update updates a data export
+func (r *DataExportRepository) Update(export *models.DataExport) error {
+	return r.db.Save(export).Error
+}
+
+// GetExpired gets the completed exports whose download link expired before now
+func (r *DataExportRepository) GetExpired(now time.Time) ([]models.DataExport, error) {
+	var exports []models.DataExport
+	if err := r.db.Where("status = ? AND expires_at <= ?", models.DataExportStatusCompleted, now).Find(&exports).Error; err != nil {
+		return nil, err
+	}
+	return exports, nil
+}
+
+// Delete deletes a data export
+func (r *DataExportRepository) Delete(id uuid.UUID) error {
+	return r.db.Delete(&models.DataExport{}, "id = ?", id).Error
+}
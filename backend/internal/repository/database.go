@@ -69,6 +69,16 @@ func (d *Database) AutoMigrate() error {
 		&models.MessageGroup{},
 		&models.Message{},
 		&models.SharedAccess{},
+		&models.ThreadReply{},
+		&models.MonthlyUsage{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.UserToken{},
+		&models.RecoveryCode{},
+		&models.UserIdentity{},
+		&models.APIKey{},
+		&models.AccountTombstone{},
+		&models.DataExport{},
 	)
 }
 
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// GroupLandingCache keeps the public landing data of groups in Redis, keyed by slug, so
+// share pages opened by many senders do not all hit the database
+type GroupLandingCache struct {
+	redis *redis.Client
+	ttl   time.Duration
+}
+
+// NewGroupLandingCache creates a new group landing cache keeping entries for ttl
+func NewGroupLandingCache(rdb *redis.Client, ttl time.Duration) *GroupLandingCache {
+	return &GroupLandingCache{
+		redis: rdb,
+		ttl:   ttl,
+	}
+}
+
+// Get gets the cached landing data of a group, nil if it is not cached
+func (c *GroupLandingCache) Get(ctx context.Context, slug string) ([]byte, error) {
+	data, err := c.redis.Get(ctx, groupLandingKey(slug)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return data, err
+}
+
+// Set caches the landing data of a group
+func (c *GroupLandingCache) Set(ctx context.Context, slug string, data []byte) error {
+	return c.redis.Set(ctx, groupLandingKey(slug), data, c.ttl).Err()
+}
+
+// Delete removes the landing data of a group from the cache
+func (c *GroupLandingCache) Delete(ctx context.Context, slug string) error {
+	return c.redis.Del(ctx, groupLandingKey(slug)).Err()
+}
+
+// groupLandingKey returns the Redis key holding the landing data of a group
+func groupLandingKey(slug string) string {
+	return "papo-reto:landing:" + slug
+}
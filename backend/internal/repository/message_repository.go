@@ -47,11 +47,39 @@ func (r *MessageRepository) GetByGroupID(groupID uuid.UUID) ([]models.Message, e
 	return messages, nil
 }
 
-// GetByGroupIDPaginated gets paginated messages for a group
-func (r *MessageRepository) GetByGroupIDPaginated(groupID uuid.UUID, page, pageSize int) ([]models.Message, error) {
+// EachByGroupIDs calls fn with every message of the given groups, oldest first.
+// Rows are read one at a time so any number of messages can be walked through.
+func (r *MessageRepository) EachByGroupIDs(groupIDs []uuid.UUID, fn func(message *models.Message) error) error {
+	if len(groupIDs) == 0 {
+		return nil
+	}
+
+	rows, err := r.db.Model(&models.Message{}).
+		Where("group_id IN ?", groupIDs).
+		Order("created_at ASC, id ASC").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var message models.Message
+		if err := r.db.ScanRows(rows, &message); err != nil {
+			return err
+		}
+		if err := fn(&message); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// GetByGroupIDPaginated gets paginated messages for a group with one of the given moderation statuses
+func (r *MessageRepository) GetByGroupIDPaginated(groupID uuid.UUID, statuses []string, page, pageSize int) ([]models.Message, error) {
 	var messages []models.Message
 	offset := (page - 1) * pageSize
-	if err := r.db.Where("group_id = ?", groupID).
+	if err := r.db.Where("group_id = ? AND moderation_status IN ?", groupID, statuses).
 		Order("created_at DESC").
 		Offset(offset).
 		Limit(pageSize).
@@ -61,14 +89,105 @@ func (r *MessageRepository) GetByGroupIDPaginated(groupID uuid.UUID, page, pageS
 	return messages, nil
 }
 
-// Update updates a message
-func (r *MessageRepository) Update(message *models.Message) error {
-	return r.db.Save(message).Error
+// GetPublicAnswers gets a page of the publicly answered, approved messages of a group, most
+// recently answered first. The page starts after the message answered at afterTime with
+// afterID when afterTime is set.
+func (r *MessageRepository) GetPublicAnswers(groupID uuid.UUID, afterTime *time.Time, afterID uuid.UUID, limit int) ([]models.Message, error) {
+	var messages []models.Message
+	query := r.db.Where("group_id = ? AND moderation_status = ? AND is_answer_public = ? AND answered_at IS NOT NULL",
+		groupID, models.ModerationStatusApproved, true)
+	if afterTime != nil {
+		query = query.Where("(answered_at, id) < (?, ?)", *afterTime, afterID)
+	}
+	if err := query.Order("answered_at DESC, id DESC").Limit(limit).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// UpdateColumns updates only the given columns of a message. The other columns keep their value
+// in the database, so concurrent changes to them, such as moderation decisions, are not reverted.
+func (r *MessageRepository) UpdateColumns(id uuid.UUID, columns map[string]interface{}) error {
+	return r.db.Model(&models.Message{}).Where("id = ?", id).Updates(columns).Error
 }
 
-// Delete deletes a message
+// UpdateAnswer saves the answer of a message, or its removal
+func (r *MessageRepository) UpdateAnswer(message *models.Message) error {
+	return r.UpdateColumns(message.ID, map[string]interface{}{
+		"answer":           message.Answer,
+		"answered_at":      message.AnsweredAt,
+		"answered_by":      message.AnsweredBy,
+		"is_answer_public": message.IsAnswerPublic,
+	})
+}
+
+// CloseThread closes the thread of a message if it is still open and reports whether it was closed
+func (r *MessageRepository) CloseThread(id uuid.UUID, closedAt time.Time) (bool, error) {
+	result := r.db.Model(&models.Message{}).
+		Where("id = ? AND thread_closed_at IS NULL", id).
+		Update("thread_closed_at", closedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetByReceiptTokenHash gets a message with its group by the hash of the sender's receipt token
+func (r *MessageRepository) GetByReceiptTokenHash(hash string) (*models.Message, error) {
+	var message models.Message
+	if err := r.db.Preload("Group").First(&message, "receipt_token_hash = ?", hash).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("message not found")
+		}
+		return nil, err
+	}
+	return &message, nil
+}
+
+// Delete deletes a message with the replies of its thread
 func (r *MessageRepository) Delete(id uuid.UUID) error {
-	return r.db.Delete(&models.Message{}, "id = ?", id).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("message_id = ?", id).Delete(&models.ThreadReply{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Message{}, "id = ?", id).Error
+	})
+}
+
+// UpdateModerationStatus sets the moderation status of messages of a group and returns how many changed.
+// The moderation reason is only replaced when a new one is given.
+func (r *MessageRepository) UpdateModerationStatus(groupID uuid.UUID, ids []uuid.UUID, status, reason string) (int64, error) {
+	updates := map[string]interface{}{
+		"moderation_status": status,
+	}
+	if reason != "" {
+		updates["moderation_reason"] = reason
+	}
+
+	result := r.db.Model(&models.Message{}).
+		Where("group_id = ? AND id IN ? AND moderation_status <> ?", groupID, ids, status).
+		Updates(updates)
+	return result.RowsAffected, result.Error
+}
+
+// CountByGroupIDAndStatus counts the messages of a group with a moderation status
+func (r *MessageRepository) CountByGroupIDAndStatus(groupID uuid.UUID, status string) (int64, error) {
+	var count int64
+	if err := r.db.Model(&models.Message{}).
+		Where("group_id = ? AND moderation_status = ?", groupID, status).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetByIDs gets the messages of a group with the given IDs
+func (r *MessageRepository) GetByIDs(groupID uuid.UUID, ids []uuid.UUID) ([]models.Message, error) {
+	var messages []models.Message
+	if err := r.db.Where("group_id = ? AND id IN ?", groupID, ids).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return messages, nil
 }
 
 // MarkAsRead marks a message as read
@@ -87,13 +206,20 @@ func (r *MessageRepository) ToggleFavorite(id uuid.UUID) error {
 	return r.db.Model(&message).Update("is_favorite", !message.IsFavorite).Error
 }
 
-// RevealIdentity reveals the identity of a message sender
-func (r *MessageRepository) RevealIdentity(id uuid.UUID, senderID string) error {
-	return r.db.Model(&models.Message{}).Where("id = ?", id).
+// RevealIdentity reveals the user who sent a message as its sender, if the message was sent
+// by them and is not revealed yet. It reports whether the message was revealed.
+func (r *MessageRepository) RevealIdentity(id, senderUserID uuid.UUID, senderName string) (bool, error) {
+	result := r.db.Model(&models.Message{}).
+		Where("id = ? AND sender_user_id = ? AND is_revealed = ?", id, senderUserID, false).
 		Updates(map[string]interface{}{
 			"is_revealed": true,
-			"sender_id":   senderID,
-		}).Error
+			"sender_id":   senderUserID.String(),
+			"sender_name": senderName,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
 }
 
 // CountByGroupID counts the number of messages in a group
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/testdb"
+)
+
+func TestUpdatesKeepConcurrentModerationDecisions(t *testing.T) {
+	db := testdb.New(t)
+	repo := NewMessageRepository(db)
+
+	message := testdb.Message(t, db, uuid.New(), "oi", models.ModerationStatusApproved)
+
+	// The message is rejected after it was read for the updates below
+	stale, err := repo.GetByID(message.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if _, err := repo.UpdateModerationStatus(message.GroupID, []uuid.UUID{message.ID}, models.ModerationStatusRejected, "spam"); err != nil {
+		t.Fatalf("UpdateModerationStatus: %v", err)
+	}
+
+	stale.SetAnswer("resposta", uuid.New(), true)
+	if err := repo.UpdateAnswer(stale); err != nil {
+		t.Fatalf("UpdateAnswer: %v", err)
+	}
+	if err := repo.UpdateColumns(stale.ID, map[string]interface{}{"is_favorite": true}); err != nil {
+		t.Fatalf("UpdateColumns: %v", err)
+	}
+	if closed, err := repo.CloseThread(stale.ID, time.Now()); err != nil || !closed {
+		t.Fatalf("CloseThread() = %v, %v, want true", closed, err)
+	}
+	if closed, err := repo.CloseThread(stale.ID, time.Now()); err != nil || closed {
+		t.Fatalf("second CloseThread() = %v, %v, want false", closed, err)
+	}
+
+	stored, err := repo.GetByID(message.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if stored.ModerationStatus != models.ModerationStatusRejected || stored.ModerationReason != "spam" {
+		t.Errorf("moderation = %q (%q), want the rejection to be kept", stored.ModerationStatus, stored.ModerationReason)
+	}
+	if stored.Answer != "resposta" || !stored.IsAnswerPublic || !stored.IsFavorite || !stored.IsThreadClosed() {
+		t.Errorf("updates were not saved: %+v", stored)
+	}
+}
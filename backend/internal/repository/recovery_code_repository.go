@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"gorm.io/gorm"
+)
+
+// RecoveryCodeRepository handles database operations for two-factor recovery codes
+type RecoveryCodeRepository struct {
+	db *gorm.DB
+}
+
+// NewRecoveryCodeRepository creates a new recovery code repository
+func NewRecoveryCodeRepository(db *gorm.DB) *RecoveryCodeRepository {
+	return &RecoveryCodeRepository{
+		db: db,
+	}
+}
+
+// Replace replaces every recovery code of a user with new ones
+func (r *RecoveryCodeRepository) Replace(userID uuid.UUID, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		codes := make([]models.RecoveryCode, 0, len(codeHashes))
+		for _, hash := range codeHashes {
+			codes = append(codes, models.RecoveryCode{
+				UserID:    userID,
+				CodeHash:  hash,
+				CreatedAt: time.Now(),
+			})
+		}
+
+		return tx.Create(&codes).Error
+	})
+}
+
+// Use atomically marks an unused recovery code of a user as used.
+// It reports false if the user has no unused code with that hash.
+func (r *RecoveryCodeRepository) Use(userID uuid.UUID, codeHash string) (bool, error) {
+	result := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CountUnused counts the recovery codes a user can still use
+func (r *RecoveryCodeRepository) CountUnused(userID uuid.UUID) (int64, error) {
+	var count int64
+	if err := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// DeleteByUserID deletes every recovery code of a user
+func (r *RecoveryCodeRepository) DeleteByUserID(userID uuid.UUID) error {
+	return r.db.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
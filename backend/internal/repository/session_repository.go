@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"gorm.io/gorm"
+)
+
+// SessionRepository handles database operations for sessions and their refresh tokens
+type SessionRepository struct {
+	db *gorm.DB
+}
+
+// NewSessionRepository creates a new session repository
+func NewSessionRepository(db *gorm.DB) *SessionRepository {
+	return &SessionRepository{
+		db: db,
+	}
+}
+
+// Create creates a new session
+func (r *SessionRepository) Create(session *models.Session) error {
+	return r.db.Create(session).Error
+}
+
+// GetByID gets a session by ID
+func (r *SessionRepository) GetByID(id uuid.UUID) (*models.Session, error) {
+	var session models.Session
+	if err := r.db.First(&session, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("session not found")
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetActiveByUserID gets the sessions of a user that have not been revoked and were seen since a time
+func (r *SessionRepository) GetActiveByUserID(userID uuid.UUID, since time.Time) ([]models.Session, error) {
+	var sessions []models.Session
+	if err := r.db.Where("user_id = ? AND revoked_at IS NULL AND last_seen_at >= ?", userID, since).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// TouchLastSeen records the time a session was last used
+func (r *SessionRepository) TouchLastSeen(id uuid.UUID, seenAt time.Time) error {
+	return r.db.Model(&models.Session{}).Where("id = ?", id).Update("last_seen_at", seenAt).Error
+}
+
+// GetActiveIDsByUserID gets the IDs of the sessions of a user that have not been revoked
+func (r *SessionRepository) GetActiveIDsByUserID(userID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	if err := r.db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Revoke revokes a session
+func (r *SessionRepository) Revoke(id uuid.UUID) error {
+	now := time.Now()
+	return r.db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Updates(map[string]interface{}{"revoked_at": now, "updated_at": now}).Error
+}
+
+// RevokeByIDs revokes several sessions
+func (r *SessionRepository) RevokeByIDs(ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	return r.db.Model(&models.Session{}).
+		Where("id IN ? AND revoked_at IS NULL", ids).
+		Updates(map[string]interface{}{"revoked_at": now, "updated_at": now}).Error
+}
+
+// CreateRefreshToken creates a new refresh token
+func (r *SessionRepository) CreateRefreshToken(token *models.RefreshToken) error {
+	return r.db.Create(token).Error
+}
+
+// GetRefreshTokenByHash gets a refresh token by the hash of its value, with its session
+func (r *SessionRepository) GetRefreshTokenByHash(hash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	if err := r.db.Preload("Session").First(&token, "token_hash = ?", hash).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("refresh token not found")
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkRefreshTokenUsed atomically marks a refresh token as used.
+// It reports false if the token had already been used.
+func (r *SessionRepository) MarkRefreshTokenUsed(id uuid.UUID) (bool, error) {
+	result := r.db.Model(&models.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// CleanupExpiredRefreshTokens deletes all expired refresh tokens
+func (r *SessionRepository) CleanupExpiredRefreshTokens() error {
+	return r.db.Where("expires_at < ?", time.Now()).Delete(&models.RefreshToken{}).Error
+}
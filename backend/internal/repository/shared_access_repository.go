@@ -70,11 +70,81 @@ func (r *SharedAccessRepository) GetActiveByGroupID(groupID uuid.UUID) ([]models
 	return accesses, nil
 }
 
+// GetActiveByUserID gets all active shared access accepted by a user, with their groups
+func (r *SharedAccessRepository) GetActiveByUserID(userID uuid.UUID) ([]models.SharedAccess, error) {
+	var accesses []models.SharedAccess
+	now := time.Now()
+	if err := r.db.Preload("Group").
+		Where("user_id = ? AND is_active = ? AND (expires_at IS NULL OR expires_at > ?)", userID, true, now).
+		Find(&accesses).Error; err != nil {
+		return nil, err
+	}
+	return accesses, nil
+}
+
+// GetRelatedToUser gets all shared access to the given groups and all shared access a user sent or accepted
+func (r *SharedAccessRepository) GetRelatedToUser(userID uuid.UUID, groupIDs []uuid.UUID) ([]models.SharedAccess, error) {
+	var accesses []models.SharedAccess
+	query := r.db.Where("user_id = ? OR invited_by = ?", userID, userID)
+	if len(groupIDs) > 0 {
+		query = query.Or("group_id IN ?", groupIDs)
+	}
+	if err := query.Order("created_at ASC").Find(&accesses).Error; err != nil {
+		return nil, err
+	}
+	return accesses, nil
+}
+
+// HasAccess checks if a user has accepted an active shared access to a group
+func (r *SharedAccessRepository) HasAccess(groupID, userID uuid.UUID) (bool, error) {
+	var count int64
+	now := time.Now()
+	if err := r.db.Model(&models.SharedAccess{}).
+		Where("group_id = ? AND user_id = ? AND is_active = ? AND (expires_at IS NULL OR expires_at > ?)",
+			groupID, userID, true, now).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetRole gets the role granted to a user by an accepted active shared access, empty if there is none
+func (r *SharedAccessRepository) GetRole(groupID, userID uuid.UUID) (string, error) {
+	var access models.SharedAccess
+	now := time.Now()
+	if err := r.db.Where("group_id = ? AND user_id = ? AND is_active = ? AND (expires_at IS NULL OR expires_at > ?)",
+		groupID, userID, true, now).
+		Order("created_at DESC").
+		First(&access).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	return access.Role, nil
+}
+
 // Update updates a shared access
 func (r *SharedAccessRepository) Update(access *models.SharedAccess) error {
 	return r.db.Save(access).Error
 }
 
+// Accept binds an invitation to the user who redeemed it, if it is still active, unexpired and
+// not accepted yet. It reports whether the invitation was accepted, so a revoke or another
+// acceptance made since the invitation was read wins.
+func (r *SharedAccessRepository) Accept(id, userID uuid.UUID, acceptedAt time.Time) (bool, error) {
+	result := r.db.Model(&models.SharedAccess{}).
+		Where("id = ? AND is_active = ? AND user_id IS NULL AND (expires_at IS NULL OR expires_at > ?)", id, true, acceptedAt).
+		Updates(map[string]interface{}{
+			"user_id":     userID,
+			"accepted_at": acceptedAt,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
 // Revoke revokes a shared access
 func (r *SharedAccessRepository) Revoke(id uuid.UUID) error {
 	return r.db.Model(&models.SharedAccess{}).Where("id = ?", id).
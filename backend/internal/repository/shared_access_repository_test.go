@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/testdb"
+)
+
+func TestAcceptSharedAccess(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name   string
+		access models.SharedAccess
+		want   bool
+	}{
+		{"pending", models.SharedAccess{IsActive: true}, true},
+		{"revoked", models.SharedAccess{IsActive: false}, false},
+		{"expired", models.SharedAccess{IsActive: true, ExpiresAt: &past}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewSharedAccessRepository(testdb.New(t))
+
+			access := tt.access
+			access.GroupID = uuid.New()
+			access.Token = uuid.NewString()
+			if err := repo.Create(&access); err != nil {
+				t.Fatalf("failed to create shared access: %v", err)
+			}
+			// Create fills in the default of false booleans
+			if err := repo.db.Model(&access).Update("is_active", tt.access.IsActive).Error; err != nil {
+				t.Fatalf("failed to update shared access: %v", err)
+			}
+
+			accepted, err := repo.Accept(access.ID, uuid.New(), time.Now())
+			if err != nil || accepted != tt.want {
+				t.Fatalf("Accept() = %v, %v, want %v", accepted, err, tt.want)
+			}
+
+			// Only the first of two acceptances binds the invitation
+			if accepted, err := repo.Accept(access.ID, uuid.New(), time.Now()); err != nil || accepted {
+				t.Errorf("second Accept() = %v, %v, want false", accepted, err)
+			}
+		})
+	}
+}
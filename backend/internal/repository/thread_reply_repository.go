@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ThreadReplyRepository handles database operations for thread replies
+type ThreadReplyRepository struct {
+	db *gorm.DB
+}
+
+// NewThreadReplyRepository creates a new thread reply repository
+func NewThreadReplyRepository(db *gorm.DB) *ThreadReplyRepository {
+	return &ThreadReplyRepository{
+		db: db,
+	}
+}
+
+// Create creates a new thread reply
+func (r *ThreadReplyRepository) Create(reply *models.ThreadReply) error {
+	return r.db.Create(reply).Error
+}
+
+// CreateWithinLimit creates a reply unless its message already has max replies, it reports
+// whether the reply was created. The message row is locked while counting, so concurrent
+// replies cannot go over the limit.
+func (r *ThreadReplyRepository) CreateWithinLimit(reply *models.ThreadReply, max int64) (bool, error) {
+	created := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var message models.Message
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").
+			First(&message, "id = ?", reply.MessageID).Error; err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&models.ThreadReply{}).Where("message_id = ?", reply.MessageID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= max {
+			return nil
+		}
+
+		if err := tx.Create(reply).Error; err != nil {
+			return err
+		}
+		created = true
+		return nil
+	})
+	return created, err
+}
+
+// GetByMessageID gets the replies to a message, oldest first
+func (r *ThreadReplyRepository) GetByMessageID(messageID uuid.UUID) ([]models.ThreadReply, error) {
+	var replies []models.ThreadReply
+	if err := r.db.Where("message_id = ?", messageID).Order("created_at ASC, id ASC").Find(&replies).Error; err != nil {
+		return nil, err
+	}
+	return replies, nil
+}
+
+// EachByGroupIDs calls fn with every reply to the messages of the given groups, oldest first.
+// Rows are read one at a time so any number of replies can be walked through.
+func (r *ThreadReplyRepository) EachByGroupIDs(groupIDs []uuid.UUID, fn func(reply *models.ThreadReply) error) error {
+	if len(groupIDs) == 0 {
+		return nil
+	}
+
+	rows, err := r.db.Model(&models.ThreadReply{}).
+		Where("message_id IN (?)", r.db.Model(&models.Message{}).Select("id").Where("group_id IN ?", groupIDs)).
+		Order("created_at ASC, id ASC").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reply models.ThreadReply
+		if err := r.db.ScanRows(rows, &reply); err != nil {
+			return err
+		}
+		if err := fn(&reply); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
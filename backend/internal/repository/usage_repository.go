@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"gorm.io/gorm"
+)
+
+// UsageRepository handles database operations for monthly usage
+type UsageRepository struct {
+	db *gorm.DB
+}
+
+// NewUsageRepository creates a new usage repository
+func NewUsageRepository(db *gorm.DB) *UsageRepository {
+	return &UsageRepository{
+		db: db,
+	}
+}
+
+// GetMessageCount gets the number of messages a user received in a period
+func (r *UsageRepository) GetMessageCount(userID uuid.UUID, period string) (int, error) {
+	var usage models.MonthlyUsage
+	if err := r.db.First(&usage, "user_id = ? AND period = ?", userID, period).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return usage.MessageCount, nil
+}
+
+// IncrementMessageCount atomically counts a message for a user in a period unless the limit
+// has been reached, a negative limit means unlimited. It reports whether the message was counted.
+func (r *UsageRepository) IncrementMessageCount(userID uuid.UUID, period string, limit int) (bool, error) {
+	if limit == 0 {
+		return false, nil
+	}
+
+	var counts []int
+	err := r.db.Raw(`
+		INSERT INTO monthly_usages (user_id, period, message_count, created_at, updated_at)
+		VALUES (?, ?, 1, NOW(), NOW())
+		ON CONFLICT (user_id, period) DO UPDATE
+		SET message_count = monthly_usages.message_count + 1, updated_at = NOW()
+		WHERE ? < 0 OR monthly_usages.message_count < ?
+		RETURNING message_count`,
+		userID, period, limit, limit).Scan(&counts).Error
+	if err != nil {
+		return false, err
+	}
+
+	return len(counts) > 0, nil
+}
+
+// DecrementMessageCount releases a message counted for a user in a period
+func (r *UsageRepository) DecrementMessageCount(userID uuid.UUID, period string) error {
+	return r.db.Model(&models.MonthlyUsage{}).
+		Where("user_id = ? AND period = ? AND message_count > 0", userID, period).
+		UpdateColumn("message_count", gorm.Expr("message_count - ?", 1)).Error
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"gorm.io/gorm"
+)
+
+// UserIdentityRepository handles database operations for external identities
+type UserIdentityRepository struct {
+	db *gorm.DB
+}
+
+// NewUserIdentityRepository creates a new user identity repository
+func NewUserIdentityRepository(db *gorm.DB) *UserIdentityRepository {
+	return &UserIdentityRepository{
+		db: db,
+	}
+}
+
+// Create creates a new user identity
+func (r *UserIdentityRepository) Create(identity *models.UserIdentity) error {
+	return r.db.Create(identity).Error
+}
+
+// GetByProviderSubject gets an identity by provider and the user's ID at that provider
+func (r *UserIdentityRepository) GetByProviderSubject(provider, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	if err := r.db.Preload("User").First(&identity, "provider = ? AND subject = ?", provider, subject).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("identity not found")
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// GetByUserID gets all identities linked to a user
+func (r *UserIdentityRepository) GetByUserID(userID uuid.UUID) ([]models.UserIdentity, error) {
+	var identities []models.UserIdentity
+	if err := r.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
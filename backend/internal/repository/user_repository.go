@@ -8,6 +8,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/ralfferreira/papo-reto/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // UserRepository handles database operations for users
@@ -56,9 +57,131 @@ func (r *UserRepository) Update(user *models.User) error {
 	return r.db.Save(user).Error
 }
 
-// Delete deletes a user
-func (r *UserRepository) Delete(id uuid.UUID) error {
-	return r.db.Delete(&models.User{}, "id = ?", id).Error
+// GetDueForDeletion gets the IDs of users whose scheduled deletion is due
+func (r *UserRepository) GetDueForDeletion(now time.Time, limit int) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	if err := r.db.Model(&models.User{}).
+		Where("deletion_scheduled_for <= ?", now).
+		Order("deletion_scheduled_for ASC").
+		Limit(limit).
+		Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Purge deletes a user with everything they own in a single transaction and records the
+// tombstone, whose counts are filled in. Messages the user sent to other groups are kept
+// but no longer linked to them. The deleted groups are returned with their IDs and slugs.
+func (r *UserRepository) Purge(userID uuid.UUID, tombstone *models.AccountTombstone) ([]models.MessageGroup, error) {
+	var groups []models.MessageGroup
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		// Lock the user so concurrent purges wait and then find it gone
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "id = ?", userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("user not found")
+			}
+			return err
+		}
+
+		// The deletion may have been cancelled since it was found due
+		if user.DeletionScheduledFor == nil || user.DeletionScheduledFor.After(time.Now()) {
+			return errors.New("user deletion is not due")
+		}
+
+		if err := tx.Select("id", "slug").Where("user_id = ?", userID).Find(&groups).Error; err != nil {
+			return err
+		}
+		groupIDs := make([]uuid.UUID, len(groups))
+		for i, group := range groups {
+			groupIDs[i] = group.ID
+		}
+
+		// Messages, with their threads, and shared access of the user's groups
+		if len(groupIDs) > 0 {
+			if err := tx.Where("message_id IN (?)", tx.Model(&models.Message{}).Select("id").Where("group_id IN ?", groupIDs)).
+				Delete(&models.ThreadReply{}).Error; err != nil {
+				return err
+			}
+
+			result := tx.Where("group_id IN ?", groupIDs).Delete(&models.Message{})
+			if result.Error != nil {
+				return result.Error
+			}
+			tombstone.MessagesDeleted = result.RowsAffected
+
+			result = tx.Where("group_id IN ?", groupIDs).Delete(&models.SharedAccess{})
+			if result.Error != nil {
+				return result.Error
+			}
+			tombstone.SharedAccessDeleted = result.RowsAffected
+		}
+
+		// Invitations the user sent or accepted in other groups
+		result := tx.Where("user_id = ? OR invited_by = ?", userID, userID).Delete(&models.SharedAccess{})
+		if result.Error != nil {
+			return result.Error
+		}
+		tombstone.SharedAccessDeleted += result.RowsAffected
+
+		// Groups
+		result = tx.Where("user_id = ?", userID).Delete(&models.MessageGroup{})
+		if result.Error != nil {
+			return result.Error
+		}
+		tombstone.GroupsDeleted = result.RowsAffected
+
+		// Identity revealed in, or recorded for, messages sent to other groups
+		if err := tx.Model(&models.Message{}).
+			Where("sender_id = ? OR sender_user_id = ?", userID.String(), userID).
+			Updates(map[string]interface{}{"sender_id": nil, "sender_name": "", "is_revealed": false, "sender_user_id": nil}).Error; err != nil {
+			return err
+		}
+
+		// Replies the user wrote for other groups are kept without their author
+		if err := tx.Model(&models.ThreadReply{}).Where("author_id = ?", userID).Update("author_id", nil).Error; err != nil {
+			return err
+		}
+
+		// Sessions and their refresh tokens
+		if err := tx.Where("session_id IN (?)", tx.Model(&models.Session{}).Select("id").Where("user_id = ?", userID)).
+			Delete(&models.RefreshToken{}).Error; err != nil {
+			return err
+		}
+
+		result = tx.Where("user_id = ?", userID).Delete(&models.Session{})
+		if result.Error != nil {
+			return result.Error
+		}
+		tombstone.SessionsDeleted = result.RowsAffected
+
+		// Everything else keyed by the user
+		for _, model := range []interface{}{
+			&models.UserToken{},
+			&models.RecoveryCode{},
+			&models.UserIdentity{},
+			&models.APIKey{},
+			&models.DataExport{},
+			&models.MonthlyUsage{},
+		} {
+			if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Delete(&models.User{}, "id = ?", userID).Error; err != nil {
+			return err
+		}
+
+		tombstone.UserID = userID
+		tombstone.DeletionRequestedAt = user.DeletionRequestedAt
+		return tx.Create(tombstone).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
 }
 
 // IncrementMessageCount increments the message count for a user
@@ -241,3 +364,15 @@ func (r *UserRepository) GetUserRegistrationStats(interval string) ([]struct {
 
 	return results, err
 }
+
+// AdvanceTOTPCounter atomically records the time step of an accepted TOTP code.
+// It reports false if a code of the same or a later time step was already accepted.
+func (r *UserRepository) AdvanceTOTPCounter(userID uuid.UUID, counter int64) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND totp_last_counter < ?", userID, counter).
+		UpdateColumn("totp_last_counter", counter)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
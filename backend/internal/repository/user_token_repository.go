@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"gorm.io/gorm"
+)
+
+// UserTokenRepository handles database operations for user tokens
+type UserTokenRepository struct {
+	db *gorm.DB
+}
+
+// NewUserTokenRepository creates a new user token repository
+func NewUserTokenRepository(db *gorm.DB) *UserTokenRepository {
+	return &UserTokenRepository{
+		db: db,
+	}
+}
+
+// Create creates a new user token
+func (r *UserTokenRepository) Create(token *models.UserToken) error {
+	return r.db.Create(token).Error
+}
+
+// GetByHash gets a user token by purpose and the hash of its value
+func (r *UserTokenRepository) GetByHash(purpose, hash string) (*models.UserToken, error) {
+	var token models.UserToken
+	if err := r.db.First(&token, "purpose = ? AND token_hash = ?", purpose, hash).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("token not found")
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// GetByBindingHash gets the most recent user token for a purpose bound to a browser
+func (r *UserTokenRepository) GetByBindingHash(purpose, hash string) (*models.UserToken, error) {
+	var token models.UserToken
+	if err := r.db.Where("purpose = ? AND binding_hash = ?", purpose, hash).
+		Order("created_at DESC").
+		First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("token not found")
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// IncrementAttempts counts a failed attempt at a user token
+func (r *UserTokenRepository) IncrementAttempts(id uuid.UUID) error {
+	return r.db.Model(&models.UserToken{}).
+		Where("id = ?", id).
+		Update("attempts", gorm.Expr("attempts + 1")).Error
+}
+
+// MarkUsed atomically marks a user token as used.
+// It reports false if the token had already been used.
+func (r *UserTokenRepository) MarkUsed(id uuid.UUID) (bool, error) {
+	result := r.db.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// InvalidateByUserID marks every unused token of a user for a purpose as used
+func (r *UserTokenRepository) InvalidateByUserID(userID uuid.UUID, purpose string) error {
+	return r.db.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error
+}
+
+// CleanupExpired deletes all expired user tokens
+func (r *UserTokenRepository) CleanupExpired() error {
+	return r.db.Where("expires_at < ?", time.Now()).Delete(&models.UserToken{}).Error
+}
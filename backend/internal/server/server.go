@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"log"
 	"net/http"
 	"time"
 
@@ -9,21 +10,29 @@ import (
 	"github.com/ralfferreira/papo-reto/internal/auth"
 	"github.com/ralfferreira/papo-reto/internal/config"
 	"github.com/ralfferreira/papo-reto/internal/handlers"
+	"github.com/ralfferreira/papo-reto/internal/mail"
 	"github.com/ralfferreira/papo-reto/internal/middleware"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/oidc"
+	"github.com/ralfferreira/papo-reto/internal/ratelimit"
+	"github.com/ralfferreira/papo-reto/internal/realtime"
 	"github.com/ralfferreira/papo-reto/internal/repository"
 	"github.com/ralfferreira/papo-reto/internal/services"
 )
 
 // Server represents the HTTP server
 type Server struct {
-	config *config.Config
-	router *gin.Engine
-	server *http.Server
-	db     *repository.Database
+	config   *config.Config
+	router   *gin.Engine
+	server   *http.Server
+	db       *repository.Database
+	hub      *realtime.Hub
+	purger   *services.AccountDeletionService
+	exporter *services.DataExportService
 }
 
 // NewServer creates a new server
-func NewServer(cfg *config.Config, db *repository.Database) *Server {
+func NewServer(cfg *config.Config, db *repository.Database) (*Server, error) {
 	// Create router
 	router := gin.Default()
 
@@ -31,61 +40,194 @@ func NewServer(cfg *config.Config, db *repository.Database) *Server {
 	router.Use(middleware.CORSMiddleware())
 
 	// Create JWT service
-	jwtService := auth.NewJWTService(cfg)
+	jwtService, err := auth.NewJWTService(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	// Create auth middleware
-	authMiddleware := middleware.NewAuthMiddleware(jwtService)
+	// Revoked sessions are remembered as long as their access tokens live, active ones for a minute
+	sessionCache := auth.NewSessionCache(db.Redis, jwtService.AccessTokenExpiry(), time.Minute)
+
+	// Create mailer
+	mailer, err := mail.NewMailer(cfg.Mail)
+	if err != nil {
+		return nil, err
+	}
 
 	// Create repositories
 	userRepo := repository.NewUserRepository(db.DB)
 	groupRepo := repository.NewMessageGroupRepository(db.DB)
 	messageRepo := repository.NewMessageRepository(db.DB)
 	sharedAccessRepo := repository.NewSharedAccessRepository(db.DB)
+	usageRepo := repository.NewUsageRepository(db.DB)
+	sessionRepo := repository.NewSessionRepository(db.DB)
+	userTokenRepo := repository.NewUserTokenRepository(db.DB)
+	recoveryCodeRepo := repository.NewRecoveryCodeRepository(db.DB)
+	identityRepo := repository.NewUserIdentityRepository(db.DB)
+	apiKeyRepo := repository.NewAPIKeyRepository(db.DB)
+	dataExportRepo := repository.NewDataExportRepository(db.DB)
+	threadReplyRepo := repository.NewThreadReplyRepository(db.DB)
+
+	// Create realtime hub
+	hub := realtime.NewHub(db.Redis)
+	hub.Start()
 
 	// Create services
-	userService := services.NewUserService(userRepo, jwtService)
+	userService := services.NewUserService(userRepo, usageRepo)
+	sessionService := services.NewSessionService(sessionRepo, userRepo, jwtService, sessionCache, cfg)
+	verificationService := services.NewVerificationService(userRepo, jwtService, mailer, cfg)
+	passwordResetService := services.NewPasswordResetService(userRepo, userTokenRepo, sessionService, mailer, cfg)
+	twoFactorService := services.NewTwoFactorService(userRepo, recoveryCodeRepo, auth.NewChallengeStore(db.Redis, 5*time.Minute, 5))
+	loginGuard := services.NewLoginGuard(auth.NewLoginThrottle(db.Redis, cfg.Login), userRepo, mailer, cfg)
+	dataExportService := services.NewDataExportService(dataExportRepo, userRepo, groupRepo, messageRepo, threadReplyRepo, sharedAccessRepo, mailer, cfg)
+	magicLinkService := services.NewMagicLinkService(userRepo, userTokenRepo, mailer, cfg)
+	oidcService := services.NewOIDCService(identityRepo, userRepo, oidc.NewStateStore(db.Redis, 10*time.Minute), cfg)
 	groupService := services.NewMessageGroupService(groupRepo, userRepo)
+	landingService := services.NewGroupLandingService(groupRepo, repository.NewGroupLandingCache(db.Redis, 5*time.Minute))
+	accountDeletionService := services.NewAccountDeletionService(userRepo, sessionService, dataExportService, landingService, mailer, cfg)
+	policy := services.NewAccessPolicy(groupRepo, messageRepo, sharedAccessRepo)
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo)
+	threadService := services.NewThreadService(messageRepo, threadReplyRepo, userRepo, policy)
+
+	// Create auth middleware
+	streamTickets := auth.NewTicketStore(db.Redis, 30*time.Second)
+	authMiddleware := middleware.NewAuthMiddleware(jwtService, sessionService, apiKeyService, streamTickets)
 
 	// Create handlers
-	authHandler := handlers.NewAuthHandler(userService)
+	authHandler := handlers.NewAuthHandler(userService, sessionService, verificationService, passwordResetService, twoFactorService, loginGuard)
 	userHandler := handlers.NewUserHandler(userService)
-	groupHandler := handlers.NewGroupHandler(groupService)
+	twoFactorHandler := handlers.NewTwoFactorHandler(twoFactorService)
+	oidcHandler := handlers.NewOIDCHandler(oidcService, sessionService, twoFactorService, cfg)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+	sessionHandler := handlers.NewSessionHandler(sessionService)
+	accountHandler := handlers.NewAccountHandler(accountDeletionService)
+	dataExportHandler := handlers.NewDataExportHandler(dataExportService)
+	magicLinkHandler := handlers.NewMagicLinkHandler(magicLinkService, sessionService, twoFactorService, loginGuard, cfg)
+	groupHandler := handlers.NewGroupHandler(groupService, landingService, policy, hub)
+	realtimeHandler := handlers.NewRealtimeHandler(hub, policy, streamTickets, cfg)
+	threadHandler := handlers.NewThreadHandler(threadService, hub)
+
+	// Public keys other services verify access tokens with
+	router.GET("/.well-known/jwks.json", handlers.GetJWKS(jwtService))
+
+	// Endpoints emailing an address from the request are throttled per IP and per address
+	limiter := ratelimit.NewRedisLimiter(db.Redis)
+	emailRateLimit := middleware.EmailRateLimit(limiter, cfg.RateLimit)
 
 	// Public routes
 	router.POST("/api/v1/auth/register", authHandler.Register)
 	router.POST("/api/v1/auth/login", authHandler.Login)
+	router.POST("/api/v1/auth/2fa/verify", authHandler.VerifyTwoFactor)
 	router.POST("/api/v1/auth/refresh", authHandler.RefreshToken)
+	router.POST("/api/v1/auth/verify", authHandler.VerifyEmail)
+	router.POST("/api/v1/auth/resend-verification", emailRateLimit, authHandler.ResendVerification)
+	router.POST("/api/v1/auth/forgot-password", emailRateLimit, authHandler.ForgotPassword)
+	router.POST("/api/v1/auth/reset-password", authHandler.ResetPassword)
+	router.POST("/api/v1/auth/magic-link", emailRateLimit, magicLinkHandler.RequestMagicLink)
+	router.POST("/api/v1/auth/magic-link/consume", magicLinkHandler.ConsumeMagicLink)
+	router.GET("/api/v1/auth/oidc/providers", oidcHandler.GetProviders)
+	router.GET("/api/v1/auth/oidc/:provider/authorize", oidcHandler.Authorize)
+	router.POST("/api/v1/auth/oidc/:provider/callback", oidcHandler.Callback)
+
+	// Data export downloads, authorized by the token in the emailed link
+	router.POST("/api/v1/exports/download", dataExportHandler.DownloadExport)
 
 	// Public message sending endpoint
-	router.POST("/api/v1/public/send/:slug", handlers.SendAnonymousMessage(messageRepo, groupRepo, userRepo))
+	router.POST("/api/v1/public/send/:slug", authMiddleware.OptionalAuth(), middleware.SendRateLimit(limiter, groupRepo, cfg.RateLimit), handlers.SendAnonymousMessage(messageRepo, groupRepo, userRepo, userService, hub))
+	router.GET("/api/v1/public/groups/:slug", groupHandler.GetPublicGroup)
+	router.GET("/api/v1/public/groups/:slug/answers", handlers.GetPublicAnswers(messageRepo, groupRepo))
+
+	// Anonymous conversations, authorized by the receipt token returned when sending
+	router.POST("/api/v1/public/threads", threadHandler.GetSenderThread)
+	router.POST("/api/v1/public/threads/replies", middleware.ReplyRateLimit(limiter, cfg.RateLimit), threadHandler.ReplyAsSender)
+	router.POST("/api/v1/public/threads/reveal", authMiddleware.RequireAuth(), threadHandler.RevealSender)
 
-	// Protected routes
+	// Realtime routes
+	router.GET("/api/v1/ws", authMiddleware.RequireStreamAuth(), realtimeHandler.ServeWS)
+	router.GET("/api/v1/groups/:id/events", authMiddleware.RequireStreamAuth(), realtimeHandler.ServeSSE)
+
+	// Protected routes, only available to logged in users
 	api := router.Group("/api/v1")
 	api.Use(authMiddleware.RequireAuth())
 	{
+		// Auth routes
+		api.POST("/auth/logout", authHandler.Logout)
+		api.POST("/auth/logout-all", authHandler.LogoutAll)
+
 		// User routes
 		api.GET("/user/profile", userHandler.GetProfile)
 		api.PUT("/user/profile", userHandler.UpdateProfile)
 		api.PUT("/user/password", userHandler.UpdatePassword)
 		api.PUT("/user/notifications", userHandler.UpdateNotifications)
+		api.GET("/user/usage", userHandler.GetUsage)
+		api.GET("/user/identities", oidcHandler.GetIdentities)
+		api.DELETE("/user", accountHandler.DeleteAccount)
+		api.POST("/user/deletion/cancel", accountHandler.CancelDeletion)
+		api.POST("/user/export", dataExportHandler.RequestExport)
+		api.GET("/user/export/:id", dataExportHandler.GetExport)
+
+		// Session routes
+		api.GET("/user/sessions", sessionHandler.GetSessions)
+		api.DELETE("/user/sessions/:id", sessionHandler.RevokeSession)
+
+		// Two-factor authentication routes
+		api.POST("/user/2fa/setup", twoFactorHandler.Setup)
+		api.POST("/user/2fa/enable", twoFactorHandler.Enable)
+		api.POST("/user/2fa/disable", twoFactorHandler.Disable)
+		api.POST("/user/2fa/recovery-codes", twoFactorHandler.RegenerateRecoveryCodes)
+
+		// API key routes
+		api.GET("/user/api-keys", apiKeyHandler.GetAPIKeys)
+		api.POST("/user/api-keys", apiKeyHandler.CreateAPIKey)
+		api.DELETE("/user/api-keys/:id", apiKeyHandler.RevokeAPIKey)
+
+		// Tickets opening the realtime streams
+		api.POST("/realtime/tickets", realtimeHandler.CreateTicket)
+
+		// Shared access routes
+		api.POST("/shared/accept/:token", handlers.AcceptSharedAccess(sharedAccessRepo, userRepo))
+		api.GET("/shared/groups", handlers.GetSharedGroups(sharedAccessRepo))
+	}
+
+	// Protected routes also available to API keys, each one requires a scope
+	scoped := router.Group("/api/v1")
+	scoped.Use(authMiddleware.RequireAuthOrAPIKey())
+	{
+		read := authMiddleware.RequireScope(models.APIKeyScopeMessagesRead)
+		write := authMiddleware.RequireScope(models.APIKeyScopeMessagesWrite)
+		manage := authMiddleware.RequireScope(models.APIKeyScopeGroupsManage)
+		anyScope := authMiddleware.RequireScope(models.APIKeyScopes...)
 
 		// Group routes
-		api.GET("/groups", groupHandler.GetGroups)
-		api.POST("/groups", groupHandler.CreateGroup)
-		api.GET("/groups/:id", groupHandler.GetGroup)
-		api.PUT("/groups/:id", groupHandler.UpdateGroup)
-		api.DELETE("/groups/:id", groupHandler.ArchiveGroup)
-		api.POST("/groups/:id/unarchive", groupHandler.UnarchiveGroup)
+		scoped.GET("/groups", anyScope, groupHandler.GetGroups)
+		scoped.POST("/groups", manage, groupHandler.CreateGroup)
+		scoped.GET("/groups/:id", anyScope, groupHandler.GetGroup)
+		scoped.PUT("/groups/:id", manage, groupHandler.UpdateGroup)
+		scoped.DELETE("/groups/:id", manage, groupHandler.ArchiveGroup)
+		scoped.POST("/groups/:id/unarchive", manage, groupHandler.UnarchiveGroup)
 
 		// Message routes
-		api.GET("/groups/:id/messages", handlers.GetMessages(messageRepo))
-		api.PUT("/messages/:id", handlers.UpdateMessage(messageRepo))
-		api.DELETE("/messages/:id", handlers.DeleteMessage(messageRepo))
+		scoped.GET("/groups/:id/messages", read, handlers.GetMessages(messageRepo, policy))
+		scoped.PUT("/messages/:id", write, handlers.UpdateMessage(messageRepo, policy, hub))
+		scoped.DELETE("/messages/:id", write, handlers.DeleteMessage(messageRepo, policy, hub))
+		scoped.PUT("/messages/:id/answer", write, handlers.AnswerMessage(messageRepo, policy, hub))
+		scoped.DELETE("/messages/:id/answer", write, handlers.DeleteAnswer(messageRepo, policy, hub))
+
+		// Thread routes
+		scoped.GET("/messages/:id/thread", read, threadHandler.GetThread)
+		scoped.POST("/messages/:id/thread/replies", write, threadHandler.ReplyAsMember)
+		scoped.POST("/messages/:id/thread/close", write, threadHandler.CloseThread)
+
+		// Moderation routes
+		scoped.GET("/groups/:id/moderation", read, handlers.GetModerationQueue(messageRepo, policy))
+		scoped.POST("/groups/:id/moderation/decide", write, handlers.DecideMessages(messageRepo, policy, hub))
+		scoped.POST("/messages/:id/approve", write, handlers.ApproveMessage(messageRepo, policy, hub))
+		scoped.POST("/messages/:id/reject", write, handlers.RejectMessage(messageRepo, policy, hub))
 
 		// Shared access routes
-		api.POST("/groups/:id/share", handlers.CreateSharedAccess(sharedAccessRepo, groupRepo))
-		api.GET("/groups/:id/shared", handlers.GetSharedAccess(sharedAccessRepo))
-		api.DELETE("/groups/:id/share/:shareId", handlers.RevokeSharedAccess(sharedAccessRepo))
+		scoped.POST("/groups/:id/share", manage, handlers.CreateSharedAccess(sharedAccessRepo, policy))
+		scoped.GET("/groups/:id/shared", manage, handlers.GetSharedAccess(sharedAccessRepo, policy))
+		scoped.DELETE("/groups/:id/share/:shareId", manage, handlers.RevokeSharedAccess(sharedAccessRepo, policy))
 	}
 
 	// Create HTTP server
@@ -98,15 +240,20 @@ func NewServer(cfg *config.Config, db *repository.Database) *Server {
 	}
 
 	return &Server{
-		config: cfg,
-		router: router,
-		server: server,
-		db:     db,
-	}
+		config:   cfg,
+		router:   router,
+		server:   server,
+		db:       db,
+		hub:      hub,
+		purger:   accountDeletionService,
+		exporter: dataExportService,
+	}, nil
 }
 
-// Start starts the server
+// Start starts the server and its background workers
 func (s *Server) Start() error {
+	s.purger.Start(time.Hour)
+	s.exporter.Start(time.Hour)
 	return s.server.ListenAndServe()
 }
 
@@ -115,10 +262,28 @@ func (s *Server) Shutdown() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// Close open sockets first, hijacked connections are not tracked by http.Server.
+	// They get part of the timeout only, the rest of the server is shut down even if some
+	// are still open, those are cut off when the process exits.
+	hubCtx, hubCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer hubCancel()
+	if err := s.hub.Shutdown(hubCtx); err != nil {
+		log.Printf("Failed to close realtime connections: %v", err)
+	}
+
 	if err := s.server.Shutdown(ctx); err != nil {
 		return err
 	}
 
+	// Let a running purge or export finish before the database is closed
+	if err := s.purger.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	if err := s.exporter.Shutdown(ctx); err != nil {
+		return err
+	}
+
 	if err := s.db.Close(); err != nil {
 		return err
 	}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+)
+
+// Access policy errors
+var (
+	// ErrAccessDenied is returned when a user can see a group but is not allowed to perform an action on it
+	ErrAccessDenied = errors.New("you don't have permission to perform this action")
+
+	// ErrGroupNotFound is returned for groups that do not exist or that the user cannot see
+	ErrGroupNotFound = errors.New("group not found")
+
+	// ErrMessageNotFound is returned for messages that do not exist or that the user cannot see
+	ErrMessageNotFound = errors.New("message not found")
+
+	// ErrSharedAccessNotFound is returned for shared access that does not exist or that the user cannot see
+	ErrSharedAccessNotFound = errors.New("shared access not found")
+)
+
+// Action is an operation a user can perform on a message group
+type Action string
+
+// Group actions
+const (
+	ActionViewGroup        Action = "group:view"
+	ActionUpdateGroup      Action = "group:update"
+	ActionArchiveGroup     Action = "group:archive"
+	ActionManageSharing    Action = "group:share"
+	ActionViewMessages     Action = "messages:view"
+	ActionUpdateMessages   Action = "messages:update"
+	ActionDeleteMessages   Action = "messages:delete"
+	ActionModerateMessages Action = "messages:moderate"
+	ActionAnswerMessages   Action = "messages:answer"
+)
+
+// rolePermissions lists the actions granted to each role
+var rolePermissions = map[string][]Action{
+	models.RoleOwner: {
+		ActionViewGroup, ActionUpdateGroup, ActionArchiveGroup, ActionManageSharing,
+		ActionViewMessages, ActionUpdateMessages, ActionDeleteMessages, ActionModerateMessages,
+		ActionAnswerMessages,
+	},
+	models.RoleEditor: {
+		ActionViewGroup, ActionUpdateGroup,
+		ActionViewMessages, ActionUpdateMessages, ActionDeleteMessages, ActionModerateMessages,
+		ActionAnswerMessages,
+	},
+	models.RoleModerator: {
+		ActionViewGroup,
+		ActionViewMessages, ActionUpdateMessages, ActionDeleteMessages, ActionModerateMessages,
+	},
+	models.RoleViewer: {
+		ActionViewGroup,
+		ActionViewMessages,
+	},
+}
+
+// IsValidSharedRole checks if a role can be granted through shared access
+func IsValidSharedRole(role string) bool {
+	return role == models.RoleEditor || role == models.RoleModerator || role == models.RoleViewer
+}
+
+// RoleAllows checks if a role grants an action
+func RoleAllows(role string, action Action) bool {
+	for _, allowed := range rolePermissions[role] {
+		if allowed == action {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessPolicy decides what users can do on message groups
+type AccessPolicy struct {
+	groupRepo        *repository.MessageGroupRepository
+	messageRepo      *repository.MessageRepository
+	sharedAccessRepo *repository.SharedAccessRepository
+}
+
+// NewAccessPolicy creates a new access policy
+func NewAccessPolicy(groupRepo *repository.MessageGroupRepository, messageRepo *repository.MessageRepository, sharedAccessRepo *repository.SharedAccessRepository) *AccessPolicy {
+	return &AccessPolicy{
+		groupRepo:        groupRepo,
+		messageRepo:      messageRepo,
+		sharedAccessRepo: sharedAccessRepo,
+	}
+}
+
+// RoleFor returns the role of a user in a group, empty if the user has no access
+func (p *AccessPolicy) RoleFor(group *models.MessageGroup, userID uuid.UUID) (string, error) {
+	if group.UserID == userID {
+		return models.RoleOwner, nil
+	}
+
+	return p.sharedAccessRepo.GetRole(group.ID, userID)
+}
+
+// Authorize checks if a user can perform an action on a group and returns the group.
+// Groups the user has no role on are reported as not found so their existence is not revealed.
+func (p *AccessPolicy) Authorize(groupID, userID uuid.UUID, action Action) (*models.MessageGroup, error) {
+	// Get group
+	group, err := p.groupRepo.GetByID(groupID)
+	if err != nil {
+		return nil, ErrGroupNotFound
+	}
+
+	role, err := p.RoleFor(group, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == "" {
+		return nil, ErrGroupNotFound
+	}
+
+	if !RoleAllows(role, action) {
+		return nil, ErrAccessDenied
+	}
+
+	return group, nil
+}
+
+// AuthorizeMessage checks if a user can perform an action on the group of a message and returns the message
+func (p *AccessPolicy) AuthorizeMessage(messageID, userID uuid.UUID, action Action) (*models.Message, error) {
+	// Get message
+	message, err := p.messageRepo.GetByID(messageID)
+	if err != nil {
+		return nil, ErrMessageNotFound
+	}
+
+	if _, err := p.Authorize(message.GroupID, userID, action); err != nil {
+		if errors.Is(err, ErrGroupNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// AuthorizeSharedAccess checks if a user can perform an action on the group of a shared access and returns
+// the shared access. The shared access must belong to groupID.
+func (p *AccessPolicy) AuthorizeSharedAccess(groupID, shareID, userID uuid.UUID, action Action) (*models.SharedAccess, error) {
+	if _, err := p.Authorize(groupID, userID, action); err != nil {
+		return nil, err
+	}
+
+	// Get shared access
+	access, err := p.sharedAccessRepo.GetByID(shareID)
+	if err != nil {
+		return nil, ErrSharedAccessNotFound
+	}
+
+	if access.GroupID != groupID {
+		return nil, ErrSharedAccessNotFound
+	}
+
+	return access, nil
+}
+
+// GroupIDs returns the IDs of the groups on which a user can perform an action
+func (p *AccessPolicy) GroupIDs(userID uuid.UUID, action Action) ([]uuid.UUID, error) {
+	var groupIDs []uuid.UUID
+
+	// Owned groups
+	if RoleAllows(models.RoleOwner, action) {
+		groups, err := p.groupRepo.GetByUserID(userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			groupIDs = append(groupIDs, group.ID)
+		}
+	}
+
+	// Shared groups
+	accesses, err := p.sharedAccessRepo.GetActiveByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, access := range accesses {
+		if RoleAllows(access.Role, action) {
+			groupIDs = append(groupIDs, access.GroupID)
+		}
+	}
+
+	return groupIDs, nil
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+	"github.com/ralfferreira/papo-reto/internal/testdb"
+	"gorm.io/gorm"
+)
+
+// allActions lists every action of the access policy
+var allActions = []Action{
+	ActionViewGroup,
+	ActionUpdateGroup,
+	ActionArchiveGroup,
+	ActionManageSharing,
+	ActionViewMessages,
+	ActionUpdateMessages,
+	ActionDeleteMessages,
+	ActionModerateMessages,
+	ActionAnswerMessages,
+}
+
+// policyFixture is a group with its owner, a collaborator for each shared role and a stranger
+type policyFixture struct {
+	db      *gorm.DB
+	policy  *AccessPolicy
+	group   *models.MessageGroup
+	message *models.Message
+	owner   uuid.UUID
+	members map[string]uuid.UUID
+	nobody  uuid.UUID
+}
+
+// newTestPolicy creates an access policy reading from db
+func newTestPolicy(db *gorm.DB) *AccessPolicy {
+	return NewAccessPolicy(repository.NewMessageGroupRepository(db), repository.NewMessageRepository(db), repository.NewSharedAccessRepository(db))
+}
+
+func newPolicyFixture(t *testing.T) *policyFixture {
+	t.Helper()
+
+	db := testdb.New(t)
+	f := &policyFixture{
+		db:      db,
+		policy:  newTestPolicy(db),
+		owner:   uuid.New(),
+		members: make(map[string]uuid.UUID),
+		nobody:  uuid.New(),
+	}
+	f.group = testdb.Group(t, db, f.owner, "equipe")
+	f.message = testdb.Message(t, db, f.group.ID, "oi", models.ModerationStatusApproved)
+
+	for _, role := range []string{models.RoleEditor, models.RoleModerator, models.RoleViewer} {
+		userID := uuid.New()
+		f.share(t, userID, role, true, nil)
+		f.members[role] = userID
+	}
+
+	return f
+}
+
+// share grants a role on the fixture's group to a user through an accepted shared access
+func (f *policyFixture) share(t *testing.T, userID uuid.UUID, role string, active bool, expiresAt *time.Time) *models.SharedAccess {
+	t.Helper()
+
+	access := &models.SharedAccess{
+		GroupID:   f.group.ID,
+		InvitedBy: f.owner,
+		Email:     userID.String() + "@example.com",
+		Token:     uuid.NewString(),
+		Role:      role,
+		ExpiresAt: expiresAt,
+	}
+	access.Accept(userID)
+	testdb.Create(t, f.db, access)
+
+	// The column defaults to true, so an inactive row is written after the insert
+	if !active {
+		if err := f.db.Model(access).Update("is_active", false).Error; err != nil {
+			t.Fatalf("failed to deactivate shared access: %v", err)
+		}
+	}
+
+	return access
+}
+
+func TestAccessPolicyRoleActionMatrix(t *testing.T) {
+	f := newPolicyFixture(t)
+
+	// Expected outcome of every action for every role, nil means allowed
+	denied, hidden := ErrAccessDenied, ErrGroupNotFound
+	matrix := map[string]map[Action]error{
+		models.RoleOwner: {
+			ActionViewGroup: nil, ActionUpdateGroup: nil, ActionArchiveGroup: nil, ActionManageSharing: nil,
+			ActionViewMessages: nil, ActionUpdateMessages: nil, ActionDeleteMessages: nil,
+			ActionModerateMessages: nil, ActionAnswerMessages: nil,
+		},
+		models.RoleEditor: {
+			ActionViewGroup: nil, ActionUpdateGroup: nil, ActionArchiveGroup: denied, ActionManageSharing: denied,
+			ActionViewMessages: nil, ActionUpdateMessages: nil, ActionDeleteMessages: nil,
+			ActionModerateMessages: nil, ActionAnswerMessages: nil,
+		},
+		models.RoleModerator: {
+			ActionViewGroup: nil, ActionUpdateGroup: denied, ActionArchiveGroup: denied, ActionManageSharing: denied,
+			ActionViewMessages: nil, ActionUpdateMessages: nil, ActionDeleteMessages: nil,
+			ActionModerateMessages: nil, ActionAnswerMessages: denied,
+		},
+		models.RoleViewer: {
+			ActionViewGroup: nil, ActionUpdateGroup: denied, ActionArchiveGroup: denied, ActionManageSharing: denied,
+			ActionViewMessages: nil, ActionUpdateMessages: denied, ActionDeleteMessages: denied,
+			ActionModerateMessages: denied, ActionAnswerMessages: denied,
+		},
+		"non-member": {
+			ActionViewGroup: hidden, ActionUpdateGroup: hidden, ActionArchiveGroup: hidden, ActionManageSharing: hidden,
+			ActionViewMessages: hidden, ActionUpdateMessages: hidden, ActionDeleteMessages: hidden,
+			ActionModerateMessages: hidden, ActionAnswerMessages: hidden,
+		},
+	}
+
+	users := map[string]uuid.UUID{
+		models.RoleOwner: f.owner,
+		"non-member":     f.nobody,
+	}
+	for role, userID := range f.members {
+		users[role] = userID
+	}
+
+	for role, expected := range matrix {
+		if len(expected) != len(allActions) {
+			t.Fatalf("matrix for %s covers %d actions, want %d", role, len(expected), len(allActions))
+		}
+
+		for _, action := range allActions {
+			want := expected[action]
+			t.Run(role+"/"+string(action), func(t *testing.T) {
+				group, err := f.policy.Authorize(f.group.ID, users[role], action)
+				if !errors.Is(err, want) {
+					t.Fatalf("Authorize() error = %v, want %v", err, want)
+				}
+				if want == nil && group.ID != f.group.ID {
+					t.Errorf("Authorize() returned group %s, want %s", group.ID, f.group.ID)
+				}
+
+				// Message actions resolve to the same decision, hiding the message instead of the group
+				wantMessage := want
+				if errors.Is(want, ErrGroupNotFound) {
+					wantMessage = ErrMessageNotFound
+				}
+				message, err := f.policy.AuthorizeMessage(f.message.ID, users[role], action)
+				if !errors.Is(err, wantMessage) {
+					t.Fatalf("AuthorizeMessage() error = %v, want %v", err, wantMessage)
+				}
+				if wantMessage == nil && message.ID != f.message.ID {
+					t.Errorf("AuthorizeMessage() returned message %s, want %s", message.ID, f.message.ID)
+				}
+			})
+		}
+	}
+}
+
+func TestRoleAllowsUnknownRoles(t *testing.T) {
+	for _, role := range []string{"", "admin", "OWNER"} {
+		for _, action := range allActions {
+			if RoleAllows(role, action) {
+				t.Errorf("RoleAllows(%q, %q) = true, want false", role, action)
+			}
+		}
+	}
+}
+
+func TestAccessPolicyIgnoresInvalidSharedAccess(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		active    bool
+		expiresAt *time.Time
+		want      error
+	}{
+		{"active without expiry", true, nil, nil},
+		{"active not yet expired", true, &future, nil},
+		{"expired", true, &past, ErrGroupNotFound},
+		{"inactive", false, nil, ErrGroupNotFound},
+		{"inactive and expired", false, &past, ErrGroupNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newPolicyFixture(t)
+			userID := uuid.New()
+			f.share(t, userID, models.RoleEditor, tt.active, tt.expiresAt)
+
+			for _, action := range []Action{ActionViewGroup, ActionViewMessages, ActionUpdateMessages} {
+				_, err := f.policy.Authorize(f.group.ID, userID, action)
+				if !errors.Is(err, tt.want) {
+					t.Errorf("Authorize(%s) error = %v, want %v", action, err, tt.want)
+				}
+			}
+
+			groupIDs, err := f.policy.GroupIDs(userID, ActionViewMessages)
+			if err != nil {
+				t.Fatalf("GroupIDs: %v", err)
+			}
+			if visible := len(groupIDs) == 1; visible != (tt.want == nil) {
+				t.Errorf("GroupIDs() = %v, want group visible = %v", groupIDs, tt.want == nil)
+			}
+		})
+	}
+}
+
+func TestAccessPolicyUnacceptedInvitationGrantsNothing(t *testing.T) {
+	f := newPolicyFixture(t)
+	userID := uuid.New()
+
+	access := &models.SharedAccess{
+		GroupID:   f.group.ID,
+		InvitedBy: f.owner,
+		Email:     "convidado@example.com",
+		Token:     uuid.NewString(),
+		Role:      models.RoleEditor,
+	}
+	testdb.Create(t, f.db, access)
+
+	if _, err := f.policy.Authorize(f.group.ID, userID, ActionViewGroup); !errors.Is(err, ErrGroupNotFound) {
+		t.Errorf("Authorize() error = %v, want %v", err, ErrGroupNotFound)
+	}
+}
+
+func TestAccessPolicyAuthorizeSharedAccessChecksGroup(t *testing.T) {
+	f := newPolicyFixture(t)
+
+	// A share of the group is found
+	access := f.share(t, uuid.New(), models.RoleViewer, true, nil)
+	if _, err := f.policy.AuthorizeSharedAccess(f.group.ID, access.ID, f.owner, ActionManageSharing); err != nil {
+		t.Fatalf("AuthorizeSharedAccess() error = %v", err)
+	}
+
+	// A share of another group is not, even when the user owns the group in the URL
+	otherGroup := testdb.Group(t, f.db, uuid.New(), "outra")
+	foreign := &models.SharedAccess{GroupID: otherGroup.ID, InvitedBy: otherGroup.UserID, Token: uuid.NewString(), Role: models.RoleViewer}
+	testdb.Create(t, f.db, foreign)
+	if _, err := f.policy.AuthorizeSharedAccess(f.group.ID, foreign.ID, f.owner, ActionManageSharing); !errors.Is(err, ErrSharedAccessNotFound) {
+		t.Errorf("AuthorizeSharedAccess() error = %v, want %v", err, ErrSharedAccessNotFound)
+	}
+
+	// Collaborators without the sharing permission are denied
+	if _, err := f.policy.AuthorizeSharedAccess(f.group.ID, access.ID, f.members[models.RoleEditor], ActionManageSharing); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("AuthorizeSharedAccess() error = %v, want %v", err, ErrAccessDenied)
+	}
+}
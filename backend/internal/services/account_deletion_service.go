@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/config"
+	"github.com/ralfferreira/papo-reto/internal/mail"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// purgeBatchSize is the number of accounts purged on each run of the purge worker
+const purgeBatchSize = 50
+
+// Account deletion errors
+var (
+	ErrDeletionAlreadyScheduled = errors.New("account deletion is already scheduled")
+	ErrDeletionNotScheduled     = errors.New("account deletion is not scheduled")
+)
+
+// AccountDeletionService handles users deleting their own account. Deletions are scheduled
+// and can be cancelled during a grace period, after which a background worker purges the
+// account with everything it owns.
+type AccountDeletionService struct {
+	userRepo       *repository.UserRepository
+	sessionService *SessionService
+	exportService  *DataExportService
+	landingService *GroupLandingService
+	mailer         mail.Mailer
+	gracePeriod    time.Duration
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewAccountDeletionService creates a new account deletion service
+func NewAccountDeletionService(userRepo *repository.UserRepository, sessionService *SessionService, exportService *DataExportService, landingService *GroupLandingService, mailer mail.Mailer, cfg *config.Config) *AccountDeletionService {
+	return &AccountDeletionService{
+		userRepo:       userRepo,
+		sessionService: sessionService,
+		exportService:  exportService,
+		landingService: landingService,
+		mailer:         mailer,
+		gracePeriod:    cfg.App.DeletionGracePeriod,
+		stop:           make(chan struct{}),
+	}
+}
+
+// ScheduleDeletion schedules the deletion of a user's account once they confirm their password
+func (s *AccountDeletionService) ScheduleDeletion(ctx context.Context, userID uuid.UUID, password string) (*models.User, error) {
+	// Get user
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.IsDeletionScheduled() {
+		return nil, ErrDeletionAlreadyScheduled
+	}
+
+	// Check password
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return nil, ErrInvalidPassword
+	}
+
+	// Update user
+	now := time.Now()
+	scheduledFor := now.Add(s.gracePeriod)
+	user.DeletionRequestedAt = &now
+	user.DeletionScheduledFor = &scheduledFor
+	user.UpdatedAt = now
+
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+
+	// Notify the user, the email tells them how to cancel
+	if err := s.mailer.Send(ctx, mail.AccountDeletionScheduledEmail(user.Email, user.Name, scheduledFor)); err != nil {
+		log.Printf("Failed to send account deletion email: %v", err)
+	}
+
+	return user, nil
+}
+
+// CancelDeletion cancels the scheduled deletion of a user's account
+func (s *AccountDeletionService) CancelDeletion(userID uuid.UUID) error {
+	// Get user
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if !user.IsDeletionScheduled() {
+		return ErrDeletionNotScheduled
+	}
+
+	// Update user
+	user.DeletionRequestedAt = nil
+	user.DeletionScheduledFor = nil
+	user.UpdatedAt = time.Now()
+
+	return s.userRepo.Update(user)
+}
+
+// PurgeDue purges the accounts whose grace period is over and returns how many were purged
+func (s *AccountDeletionService) PurgeDue(ctx context.Context) (int, error) {
+	userIDs, err := s.userRepo.GetDueForDeletion(time.Now(), purgeBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, userID := range userIDs {
+		// Get user, their email is needed for the last notice
+		user, err := s.userRepo.GetByID(userID)
+		if err != nil || !user.IsDeletionScheduled() {
+			continue
+		}
+
+		// Revoke sessions first so their access tokens stop working right away
+		if err := s.sessionService.RevokeAllSessions(ctx, userID); err != nil {
+			log.Printf("Failed to revoke sessions of user %s before purge: %v", userID, err)
+			continue
+		}
+
+		tombstone := &models.AccountTombstone{
+			PurgedAt:  time.Now(),
+			CreatedAt: time.Now(),
+		}
+
+		groups, err := s.userRepo.Purge(userID, tombstone)
+		if err != nil {
+			log.Printf("Failed to purge user %s: %v", userID, err)
+			continue
+		}
+
+		// Share pages of the deleted groups must not be served from the cache
+		for i := range groups {
+			s.landingService.Invalidate(ctx, &groups[i])
+		}
+
+		// Archives of the user's data are files, outside the transaction
+		if err := s.exportService.RemoveUserArchives(userID); err != nil {
+			log.Printf("Failed to remove data exports of user %s: %v", userID, err)
+		}
+
+		if err := s.mailer.Send(ctx, mail.AccountDeletedEmail(user.Email, user.Name)); err != nil {
+			log.Printf("Failed to send account deleted email: %v", err)
+		}
+
+		log.Printf("Purged user %s: %d groups, %d messages, %d shared access, %d sessions",
+			userID, tombstone.GroupsDeleted, tombstone.MessagesDeleted, tombstone.SharedAccessDeleted, tombstone.SessionsDeleted)
+		purged++
+	}
+
+	return purged, nil
+}
+
+// Start runs PurgeDue every interval in the background until Shutdown is called
+func (s *AccountDeletionService) Start(interval time.Duration) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.PurgeDue(context.Background()); err != nil {
+				log.Printf("Failed to purge deleted accounts: %v", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Shutdown stops the purge worker, waiting for a running purge to finish
+func (s *AccountDeletionService) Shutdown(ctx context.Context) error {
+	close(s.stop)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
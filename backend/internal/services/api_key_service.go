@@ -0,0 +1,130 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/auth"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+)
+
+const (
+	// maxAPIKeysPerUser is the number of active API keys a user can have
+	maxAPIKeysPerUser = 20
+
+	// apiKeyPrefixLength is the number of characters of a key kept to identify it
+	apiKeyPrefixLength = len(auth.APIKeyPrefix) + 8
+
+	// apiKeyLastUsedPrecision is how often the last use of a key is recorded
+	apiKeyLastUsedPrecision = time.Minute
+)
+
+// API key errors
+var (
+	ErrInvalidAPIKey      = errors.New("invalid or revoked API key")
+	ErrInvalidAPIKeyScope = errors.New("invalid API key scope")
+	ErrAPIKeyNotFound     = errors.New("API key not found")
+	ErrAPIKeyLimitReached = fmt.Errorf("a user can have at most %d API keys", maxAPIKeysPerUser)
+)
+
+// APIKeyService handles personal API keys
+type APIKeyService struct {
+	apiKeyRepo *repository.APIKeyRepository
+}
+
+// NewAPIKeyService creates a new API key service
+func NewAPIKeyService(apiKeyRepo *repository.APIKeyRepository) *APIKeyService {
+	return &APIKeyService{
+		apiKeyRepo: apiKeyRepo,
+	}
+}
+
+// CreateKey creates an API key for a user and returns it with its value, which is not stored and cannot be shown again
+func (s *APIKeyService) CreateKey(userID uuid.UUID, name string, scopes []string) (*models.APIKey, string, error) {
+	// Validate scopes, ignoring duplicates
+	var granted []string
+	seen := make(map[string]bool)
+	for _, scope := range scopes {
+		if !models.IsValidAPIKeyScope(scope) {
+			return nil, "", fmt.Errorf("%w: %s", ErrInvalidAPIKeyScope, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			granted = append(granted, scope)
+		}
+	}
+
+	// Check the number of keys
+	count, err := s.apiKeyRepo.CountActiveByUserID(userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if count >= maxAPIKeysPerUser {
+		return nil, "", ErrAPIKeyLimitReached
+	}
+
+	// Generate key, only its hash is stored
+	token, _, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+	value := auth.APIKeyPrefix + token
+
+	key := &models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    value[:apiKeyPrefixLength],
+		KeyHash:   auth.HashToken(value),
+		Scopes:    strings.Join(granted, " "),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	if err := s.apiKeyRepo.Create(key); err != nil {
+		return nil, "", err
+	}
+
+	return key, value, nil
+}
+
+// GetKeys returns the active API keys of a user
+func (s *APIKeyService) GetKeys(userID uuid.UUID) ([]models.APIKey, error) {
+	return s.apiKeyRepo.GetActiveByUserID(userID)
+}
+
+// RevokeKey revokes an API key of a user
+func (s *APIKeyService) RevokeKey(userID, keyID uuid.UUID) error {
+	revoked, err := s.apiKeyRepo.Revoke(keyID, userID)
+	if err != nil {
+		return err
+	}
+
+	if !revoked {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// Authenticate returns the active API key with a value and records its use
+func (s *APIKeyService) Authenticate(value string) (*models.APIKey, error) {
+	// Get key
+	key, err := s.apiKeyRepo.GetByHash(auth.HashToken(value))
+	if err != nil || key.IsRevoked() {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// A failed update must not fail the request
+	now := time.Now()
+	if err := s.apiKeyRepo.TouchLastUsed(key.ID, now, now.Add(-apiKeyLastUsedPrecision)); err != nil {
+		log.Printf("Failed to record API key use: %v", err)
+	}
+
+	return key, nil
+}
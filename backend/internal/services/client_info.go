@@ -0,0 +1,80 @@
+package services
+
+import (
+	"net"
+	"strings"
+)
+
+// ClientInfo describes the client a session was started from
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+// userAgentBrowsers maps user agent tokens to browser names, checked in order
+// since most browsers also claim to be the ones they are based on
+var userAgentBrowsers = []struct{ token, name string }{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+}
+
+// userAgentSystems maps user agent tokens to operating system names, checked in order
+var userAgentSystems = []struct{ token, name string }{
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"Android", "Android"},
+	{"Windows", "Windows"},
+	{"Mac OS X", "macOS"},
+	{"CrOS", "ChromeOS"},
+	{"Linux", "Linux"},
+}
+
+// DeviceLabel returns a short description of the device behind a user agent, such as "Chrome on Windows"
+func (c ClientInfo) DeviceLabel() string {
+	browser := ""
+	for _, b := range userAgentBrowsers {
+		if strings.Contains(c.UserAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	system := ""
+	for _, s := range userAgentSystems {
+		if strings.Contains(c.UserAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	default:
+		return "Unknown device"
+	}
+}
+
+// TruncatedIP returns the network of the client's IP, a /24 for IPv4 and a /48 for IPv6,
+// enough to recognize a location without storing the address
+func (c ClientInfo) TruncatedIP() string {
+	ip := net.ParseIP(c.IP)
+	if ip == nil {
+		return ""
+	}
+
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return ipv4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
@@ -0,0 +1,569 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/auth"
+	"github.com/ralfferreira/papo-reto/internal/config"
+	"github.com/ralfferreira/papo-reto/internal/mail"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+)
+
+// exportStaleAfter is how long an export can run before another worker takes it over
+const exportStaleAfter = time.Hour
+
+// Data export errors
+var (
+	ErrExportInProgress   = errors.New("a data export is already in progress")
+	ErrExportNotFound     = errors.New("data export not found")
+	ErrInvalidExportToken = errors.New("invalid or expired download link")
+	ErrExportUnavailable  = errors.New("the archive is no longer available, request a new export")
+)
+
+// messageCSVHeader is the header row of messages.csv
+var messageCSVHeader = []string{
+	"id", "groupId", "icebreaker", "content", "isRead", "isFavorite",
+	"isRevealed", "senderId", "senderName", "moderationStatus", "moderationReason",
+	"answer", "answeredAt", "isAnswerPublic", "createdAt",
+}
+
+// DataExportService builds archives of a user's personal data, as the LGPD entitles them to.
+// Exports are queued in the database and built by a background worker, which emails the
+// user a time-limited download link once the archive is ready.
+type DataExportService struct {
+	exportRepo       *repository.DataExportRepository
+	userRepo         *repository.UserRepository
+	groupRepo        *repository.MessageGroupRepository
+	messageRepo      *repository.MessageRepository
+	replyRepo        *repository.ThreadReplyRepository
+	sharedAccessRepo *repository.SharedAccessRepository
+	mailer           mail.Mailer
+	dir              string
+	linkTTL          time.Duration
+	frontendURL      string
+	instance         string
+
+	wake chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewDataExportService creates a new data export service
+func NewDataExportService(exportRepo *repository.DataExportRepository, userRepo *repository.UserRepository, groupRepo *repository.MessageGroupRepository, messageRepo *repository.MessageRepository, replyRepo *repository.ThreadReplyRepository, sharedAccessRepo *repository.SharedAccessRepository, mailer mail.Mailer, cfg *config.Config) *DataExportService {
+	return &DataExportService{
+		exportRepo:       exportRepo,
+		userRepo:         userRepo,
+		groupRepo:        groupRepo,
+		messageRepo:      messageRepo,
+		replyRepo:        replyRepo,
+		sharedAccessRepo: sharedAccessRepo,
+		mailer:           mailer,
+		dir:              cfg.App.ExportDir,
+		linkTTL:          cfg.App.ExportLinkTTL,
+		frontendURL:      strings.TrimRight(cfg.App.FrontendURL, "/"),
+		instance:         cfg.App.InstanceID,
+		wake:             make(chan struct{}, 1),
+		stop:             make(chan struct{}),
+	}
+}
+
+// RequestExport queues an export of a user's data
+func (s *DataExportService) RequestExport(userID uuid.UUID) (*models.DataExport, error) {
+	// Only one export at a time
+	inProgress, err := s.exportRepo.HasInProgress(userID)
+	if err != nil {
+		return nil, err
+	}
+	if inProgress {
+		return nil, ErrExportInProgress
+	}
+
+	// Create export
+	export := &models.DataExport{
+		UserID:    userID,
+		Status:    models.DataExportStatusPending,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	if err := s.exportRepo.Create(export); err != nil {
+		return nil, err
+	}
+
+	// Let the worker pick it up without waiting for the next tick
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	return export, nil
+}
+
+// GetExport gets an export of a user
+func (s *DataExportService) GetExport(userID, exportID uuid.UUID) (*models.DataExport, error) {
+	export, err := s.exportRepo.GetByID(exportID)
+	if err != nil || export.UserID != userID {
+		return nil, ErrExportNotFound
+	}
+	return export, nil
+}
+
+// GetDownload gets the export a download link was sent for, if the link has not expired
+// and its archive can be read by this instance
+func (s *DataExportService) GetDownload(token string) (*models.DataExport, error) {
+	export, err := s.exportRepo.GetByTokenHash(auth.HashToken(token))
+	if err != nil || !export.IsDownloadable(time.Now()) {
+		return nil, ErrInvalidExportToken
+	}
+
+	// The archive is missing when it was deleted or when EXPORT_DIR is not shared by the instances
+	if _, err := os.Stat(export.FilePath); err != nil {
+		if export.Instance != s.instance {
+			log.Printf("Data export %s was built by instance %q, its archive is not in the EXPORT_DIR of %q: %v", export.ID, export.Instance, s.instance, err)
+		} else {
+			log.Printf("Data export %s has no archive: %v", export.ID, err)
+		}
+		return nil, ErrExportUnavailable
+	}
+
+	return export, nil
+}
+
+// RunPending builds every queued export and returns how many were built
+func (s *DataExportService) RunPending(ctx context.Context) (int, error) {
+	built := 0
+	for {
+		export, err := s.exportRepo.ClaimNext(time.Now(), time.Now().Add(-exportStaleAfter), s.instance)
+		if err != nil {
+			return built, err
+		}
+		if export == nil {
+			return built, nil
+		}
+
+		if err := s.build(ctx, export); err != nil {
+			log.Printf("Failed to build data export %s: %v", export.ID, err)
+
+			export.Status = models.DataExportStatusFailed
+			export.UpdatedAt = time.Now()
+			if err := s.exportRepo.Update(export); err != nil {
+				log.Printf("Failed to mark data export %s as failed: %v", export.ID, err)
+			}
+			continue
+		}
+		built++
+	}
+}
+
+// build writes the archive of an export and emails its download link
+func (s *DataExportService) build(ctx context.Context, export *models.DataExport) error {
+	// Get user
+	user, err := s.userRepo.GetByID(export.UserID)
+	if err != nil {
+		return err
+	}
+
+	// Write the archive under a temporary name so a half-written file is never served
+	userDir := filepath.Join(s.dir, user.ID.String())
+	if err := os.MkdirAll(userDir, 0o700); err != nil {
+		return err
+	}
+
+	path := filepath.Join(userDir, export.ID.String()+".zip")
+	size, err := s.writeArchive(user, path+".tmp")
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+
+	// Generate download token, only its hash is stored
+	token, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.linkTTL)
+	export.Status = models.DataExportStatusCompleted
+	export.FilePath = path
+	export.SizeBytes = size
+	export.TokenHash = hash
+	export.CompletedAt = &now
+	export.ExpiresAt = &expiresAt
+	export.UpdatedAt = now
+
+	if err := s.exportRepo.Update(export); err != nil {
+		return err
+	}
+
+	link := s.frontendURL + "/data-export?token=" + url.QueryEscape(token)
+	if err := s.mailer.Send(ctx, mail.DataExportReadyEmail(user.Email, user.Name, link, expiresAt)); err != nil {
+		log.Printf("Failed to send data export email: %v", err)
+	}
+
+	return nil
+}
+
+// writeArchive writes the ZIP archive of a user's data to path and returns its size
+func (s *DataExportService) writeArchive(user *models.User, path string) (int64, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+
+	// Profile and notification settings
+	if err := writeJSONEntry(zw, "profile.json", exportProfile(user)); err != nil {
+		return 0, err
+	}
+
+	notifySettings := user.NotifySettings
+	if notifySettings == nil {
+		notifySettings = json.RawMessage("{}")
+	}
+	if err := writeJSONEntry(zw, "notify_settings.json", notifySettings); err != nil {
+		return 0, err
+	}
+
+	// Groups with their settings
+	groups, err := s.groupRepo.GetByUserID(user.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	groupIDs := make([]uuid.UUID, 0, len(groups))
+	groupEntries := make([]map[string]interface{}, 0, len(groups))
+	for i := range groups {
+		groupIDs = append(groupIDs, groups[i].ID)
+		groupEntries = append(groupEntries, exportGroup(&groups[i]))
+	}
+
+	if err := writeJSONEntry(zw, "groups.json", groupEntries); err != nil {
+		return 0, err
+	}
+
+	// Messages, streamed once for each format
+	if err := s.writeMessagesJSON(zw, groupIDs); err != nil {
+		return 0, err
+	}
+	if err := s.writeMessagesCSV(zw, groupIDs); err != nil {
+		return 0, err
+	}
+
+	// Replies in the threads of those messages
+	if err := s.writeThreadRepliesJSON(zw, groupIDs); err != nil {
+		return 0, err
+	}
+
+	// Shared access of the user's groups and the invitations they sent or accepted
+	accesses, err := s.sharedAccessRepo.GetRelatedToUser(user.ID, groupIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	accessEntries := make([]map[string]interface{}, 0, len(accesses))
+	for i := range accesses {
+		accessEntries = append(accessEntries, exportSharedAccess(&accesses[i]))
+	}
+
+	if err := writeJSONEntry(zw, "shared_access.json", accessEntries); err != nil {
+		return 0, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// writeMessagesJSON writes messages.json one message at a time
+func (s *DataExportService) writeMessagesJSON(zw *zip.Writer, groupIDs []uuid.UUID) error {
+	return writeJSONArrayEntry(zw, "messages.json", func(emit func(v interface{}) error) error {
+		return s.messageRepo.EachByGroupIDs(groupIDs, func(message *models.Message) error {
+			return emit(exportMessage(message))
+		})
+	})
+}
+
+// writeThreadRepliesJSON writes thread_replies.json one reply at a time
+func (s *DataExportService) writeThreadRepliesJSON(zw *zip.Writer, groupIDs []uuid.UUID) error {
+	return writeJSONArrayEntry(zw, "thread_replies.json", func(emit func(v interface{}) error) error {
+		return s.replyRepo.EachByGroupIDs(groupIDs, func(reply *models.ThreadReply) error {
+			return emit(exportThreadReply(reply))
+		})
+	})
+}
+
+// writeMessagesCSV writes messages.csv one row at a time
+func (s *DataExportService) writeMessagesCSV(zw *zip.Writer, groupIDs []uuid.UUID) error {
+	w, err := zw.Create("messages.csv")
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(messageCSVHeader); err != nil {
+		return err
+	}
+
+	err = s.messageRepo.EachByGroupIDs(groupIDs, func(message *models.Message) error {
+		senderID := ""
+		if message.SenderID != nil {
+			senderID = *message.SenderID
+		}
+
+		answeredAt := ""
+		if message.AnsweredAt != nil {
+			answeredAt = message.AnsweredAt.Format(time.RFC3339)
+		}
+
+		return cw.Write([]string{
+			message.ID.String(),
+			message.GroupID.String(),
+			message.Icebreaker,
+			message.Content,
+			strconv.FormatBool(message.IsRead),
+			strconv.FormatBool(message.IsFavorite),
+			strconv.FormatBool(message.IsRevealed),
+			senderID,
+			message.SenderName,
+			message.ModerationStatus,
+			message.ModerationReason,
+			message.Answer,
+			answeredAt,
+			strconv.FormatBool(message.IsAnswerPublic),
+			message.CreatedAt.Format(time.RFC3339),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeJSONEntry writes v as an indented JSON file of the archive
+func writeJSONEntry(zw *zip.Writer, name string, v interface{}) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// writeJSONArrayEntry writes a JSON array file of the archive whose elements are emitted one
+// at a time by each, so the array never has to be held in memory
+func writeJSONArrayEntry(zw *zip.Writer, name string, each func(emit func(v interface{}) error) error) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	separator := "\n  "
+	err = each(func(v interface{}) error {
+		entry, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(w, separator); err != nil {
+			return err
+		}
+		separator = ",\n  "
+
+		_, err = w.Write(entry)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n]\n")
+	return err
+}
+
+// exportProfile returns the exported fields of a user, secrets are left out
+func exportProfile(user *models.User) map[string]interface{} {
+	return map[string]interface{}{
+		"id":               user.ID,
+		"email":            user.Email,
+		"name":             user.Name,
+		"avatarUrl":        user.AvatarURL,
+		"isVerified":       user.IsVerified,
+		"plan":             user.Plan,
+		"messageCount":     user.MessageCount,
+		"activeGroups":     user.ActiveGroups,
+		"twoFactorEnabled": user.TOTPEnabled,
+		"createdAt":        user.CreatedAt,
+		"updatedAt":        user.UpdatedAt,
+	}
+}
+
+// exportGroup returns the exported fields of a group
+func exportGroup(group *models.MessageGroup) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          group.ID,
+		"name":        group.Name,
+		"slug":        group.Slug,
+		"description": group.Description,
+		"isPublic":    group.IsPublic,
+		"isArchived":  group.IsArchived,
+		"settings":    group.Settings,
+		"createdAt":   group.CreatedAt,
+		"updatedAt":   group.UpdatedAt,
+	}
+}
+
+// exportMessage returns the exported fields of a message, the sender's IP is left out
+func exportMessage(message *models.Message) map[string]interface{} {
+	return map[string]interface{}{
+		"id":               message.ID,
+		"groupId":          message.GroupID,
+		"icebreaker":       message.Icebreaker,
+		"content":          message.Content,
+		"isRead":           message.IsRead,
+		"isFavorite":       message.IsFavorite,
+		"isRevealed":       message.IsRevealed,
+		"senderId":         message.SenderID,
+		"senderName":       message.SenderName,
+		"moderationStatus": message.ModerationStatus,
+		"moderationReason": message.ModerationReason,
+		"answer":           message.Answer,
+		"answeredAt":       message.AnsweredAt,
+		"isAnswerPublic":   message.IsAnswerPublic,
+		"createdAt":        message.CreatedAt,
+	}
+}
+
+// exportThreadReply returns the exported fields of a thread reply
+func exportThreadReply(reply *models.ThreadReply) map[string]interface{} {
+	return map[string]interface{}{
+		"id":        reply.ID,
+		"messageId": reply.MessageID,
+		"author":    reply.AuthorType,
+		"authorId":  reply.AuthorID,
+		"content":   reply.Content,
+		"createdAt": reply.CreatedAt,
+	}
+}
+
+// exportSharedAccess returns the exported fields of a shared access, its token is left out
+func exportSharedAccess(access *models.SharedAccess) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         access.ID,
+		"groupId":    access.GroupID,
+		"invitedBy":  access.InvitedBy,
+		"email":      access.Email,
+		"role":       access.Role,
+		"isActive":   access.IsActive,
+		"expiresAt":  access.ExpiresAt,
+		"userId":     access.UserID,
+		"acceptedAt": access.AcceptedAt,
+		"createdAt":  access.CreatedAt,
+	}
+}
+
+// CleanupExpired deletes the archives whose download link expired
+func (s *DataExportService) CleanupExpired() error {
+	exports, err := s.exportRepo.GetExpired(time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		if err := os.Remove(export.FilePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to remove data export %s: %v", export.ID, err)
+			continue
+		}
+		if err := s.exportRepo.Delete(export.ID); err != nil {
+			log.Printf("Failed to delete data export %s: %v", export.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// RemoveUserArchives deletes every archive of a user from disk
+func (s *DataExportService) RemoveUserArchives(userID uuid.UUID) error {
+	return os.RemoveAll(filepath.Join(s.dir, userID.String()))
+}
+
+// Start builds queued exports in the background until Shutdown is called. The worker
+// runs right away when an export is requested and every interval otherwise, which also
+// deletes expired archives and picks up exports left behind by a stopped worker.
+func (s *DataExportService) Start(interval time.Duration) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.RunPending(context.Background()); err != nil {
+				log.Printf("Failed to build data exports: %v", err)
+			}
+			if err := s.CleanupExpired(); err != nil {
+				log.Printf("Failed to clean up data exports: %v", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-s.wake:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Shutdown stops the export worker, waiting for a running export to finish
+func (s *DataExportService) Shutdown(ctx context.Context) error {
+	close(s.stop)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
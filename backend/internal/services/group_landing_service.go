@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+)
+
+const (
+	// maxIcebreakers is the number of icebreaker questions a group can have
+	maxIcebreakers = 10
+
+	// maxIcebreakerLength is the length in characters of an icebreaker question
+	maxIcebreakerLength = 200
+)
+
+// themeColorPattern matches the #rrggbb colors allowed in a group theme
+var themeColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Fields of the anonymous sending form
+const (
+	FormFieldContent    = "content"
+	FormFieldIcebreaker = "icebreaker"
+	FormFieldRevealName = "revealName"
+)
+
+// FormField describes a field of the anonymous sending form
+type FormField struct {
+	Name         string   `json:"name"`
+	Type         string   `json:"type"`
+	Required     bool     `json:"required"`
+	Options      []string `json:"options,omitempty"`
+	RequiresAuth bool     `json:"requiresAuth,omitempty"`
+}
+
+// GroupLanding is what the public share page of a group shows. It only holds fields that
+// are safe to show to anyone with the group's link.
+type GroupLanding struct {
+	Name              string               `json:"name"`
+	Slug              string               `json:"slug"`
+	Description       string               `json:"description"`
+	Icebreakers       []string             `json:"icebreakers"`
+	Theme             models.ThemeSettings `json:"theme"`
+	AcceptingMessages bool                 `json:"acceptingMessages"`
+	HasPublicAnswers  bool                 `json:"hasPublicAnswers"`
+	Fields            []FormField          `json:"fields"`
+}
+
+// GroupLandingService builds the public landing data of groups, cached by slug
+type GroupLandingService struct {
+	groupRepo *repository.MessageGroupRepository
+	cache     *repository.GroupLandingCache
+}
+
+// NewGroupLandingService creates a new group landing service
+func NewGroupLandingService(groupRepo *repository.MessageGroupRepository, cache *repository.GroupLandingCache) *GroupLandingService {
+	return &GroupLandingService{
+		groupRepo: groupRepo,
+		cache:     cache,
+	}
+}
+
+// GetLanding gets the landing data of a group by slug, as JSON
+func (s *GroupLandingService) GetLanding(ctx context.Context, slug string) ([]byte, error) {
+	// Check cache, the database is used when Redis is unavailable
+	data, err := s.cache.Get(ctx, slug)
+	if err != nil {
+		log.Printf("Failed to read group landing cache: %v", err)
+	}
+	if data != nil {
+		return data, nil
+	}
+
+	// Get group by slug
+	group, err := s.groupRepo.GetBySlug(slug)
+	if err != nil {
+		return nil, ErrGroupNotFound
+	}
+
+	data, err = json.Marshal(buildGroupLanding(group))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.cache.Set(ctx, slug, data); err != nil {
+		log.Printf("Failed to write group landing cache: %v", err)
+	}
+
+	return data, nil
+}
+
+// Invalidate removes the cached landing data of a group once it changes
+func (s *GroupLandingService) Invalidate(ctx context.Context, group *models.MessageGroup) {
+	if err := s.cache.Delete(ctx, group.Slug); err != nil {
+		log.Printf("Failed to invalidate group landing cache: %v", err)
+	}
+}
+
+// buildGroupLanding builds the landing data of a group
+func buildGroupLanding(group *models.MessageGroup) *GroupLanding {
+	icebreakers := group.GetIcebreakers()
+
+	fields := []FormField{
+		{Name: FormFieldContent, Type: "textarea", Required: true},
+	}
+	if len(icebreakers) > 0 {
+		fields = append(fields, FormField{Name: FormFieldIcebreaker, Type: "select", Options: icebreakers})
+	}
+	fields = append(fields, FormField{Name: FormFieldRevealName, Type: "checkbox", RequiresAuth: true})
+
+	return &GroupLanding{
+		Name:              group.Name,
+		Slug:              group.Slug,
+		Description:       group.Description,
+		Icebreakers:       icebreakers,
+		Theme:             group.GetTheme(),
+		AcceptingMessages: group.IsActive(),
+		HasPublicAnswers:  group.IsPublic,
+		Fields:            fields,
+	}
+}
+
+// ValidateLandingSettings checks the icebreaker and theme settings of a group before they are saved
+func ValidateLandingSettings(settings map[string]interface{}) error {
+	if value, ok := settings["icebreakers"]; ok && value != nil {
+		items, ok := value.([]interface{})
+		if !ok {
+			return errors.New("icebreakers must be a list of strings")
+		}
+		if len(items) > maxIcebreakers {
+			return fmt.Errorf("a group can have at most %d icebreakers", maxIcebreakers)
+		}
+
+		for _, item := range items {
+			question, ok := item.(string)
+			if !ok || question == "" {
+				return errors.New("icebreakers must be a list of strings")
+			}
+			if utf8.RuneCountInString(question) > maxIcebreakerLength {
+				return fmt.Errorf("icebreakers must be at most %d characters", maxIcebreakerLength)
+			}
+		}
+	}
+
+	if value, ok := settings["theme"]; ok && value != nil {
+		theme, ok := value.(map[string]interface{})
+		if !ok {
+			return errors.New("theme must be an object")
+		}
+
+		for _, field := range []string{"primaryColor", "backgroundColor"} {
+			raw, ok := theme[field]
+			if !ok {
+				continue
+			}
+
+			color, ok := raw.(string)
+			if !ok || !themeColorPattern.MatchString(color) {
+				return fmt.Errorf("theme.%s must be a #rrggbb color", field)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ralfferreira/papo-reto/internal/auth"
+	"github.com/ralfferreira/papo-reto/internal/config"
+	"github.com/ralfferreira/papo-reto/internal/mail"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+)
+
+// LoginGuard protects the login against brute force, it fails open when Redis is unavailable
+type LoginGuard struct {
+	throttle        *auth.LoginThrottle
+	userRepo        *repository.UserRepository
+	mailer          mail.Mailer
+	lockoutDuration time.Duration
+}
+
+// NewLoginGuard creates a new login guard
+func NewLoginGuard(throttle *auth.LoginThrottle, userRepo *repository.UserRepository, mailer mail.Mailer, cfg *config.Config) *LoginGuard {
+	return &LoginGuard{
+		throttle:        throttle,
+		userRepo:        userRepo,
+		mailer:          mailer,
+		lockoutDuration: cfg.Login.LockoutDuration,
+	}
+}
+
+// Check returns how long a login attempt for an email from an IP must wait, zero if it is allowed.
+// The email may be empty for steps that are not tied to an account yet.
+func (g *LoginGuard) Check(ctx context.Context, email, ip string) time.Duration {
+	wait, err := g.throttle.Check(ctx, email, ip)
+	if err != nil {
+		log.Printf("Failed to check login throttle: %v", err)
+		return 0
+	}
+	return wait
+}
+
+// RecordFailure records a failed login and returns how long the next attempt must wait.
+// The account owner is notified when the failure locks their account.
+func (g *LoginGuard) RecordFailure(ctx context.Context, email, ip string) time.Duration {
+	wait, locked, err := g.throttle.RecordFailure(ctx, email, ip)
+	if err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+		return 0
+	}
+
+	if locked {
+		// Failures are counted for unknown emails too, only real accounts get the notification.
+		// It is sent in the background so locking a real account takes as long as an unknown one.
+		go g.notifyLocked(email)
+	}
+
+	return wait
+}
+
+// RecordSuccess clears the failures of an account after a successful login
+func (g *LoginGuard) RecordSuccess(ctx context.Context, email string) {
+	if err := g.throttle.Reset(ctx, email); err != nil {
+		log.Printf("Failed to reset login throttle: %v", err)
+	}
+}
+
+// notifyLocked emails the owner of an account that was just locked, if the account exists
+func (g *LoginGuard) notifyLocked(email string) {
+	user, err := g.userRepo.GetByEmail(email)
+	if err != nil {
+		return
+	}
+
+	if err := g.mailer.Send(context.Background(), mail.AccountLockedEmail(user.Email, user.Name, g.lockoutDuration)); err != nil {
+		log.Printf("Failed to send account locked email: %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ralfferreira/papo-reto/internal/auth"
+	"github.com/ralfferreira/papo-reto/internal/config"
+	"github.com/ralfferreira/papo-reto/internal/mail"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+)
+
+const (
+	// magicLinkTTL is how long magic links and their codes are valid
+	magicLinkTTL = 15 * time.Minute
+
+	// magicLinkMaxCodeAttempts is the number of wrong codes that invalidates a magic link
+	magicLinkMaxCodeAttempts = 5
+)
+
+// Magic link errors
+var (
+	ErrInvalidMagicLink      = errors.New("invalid or expired sign-in link")
+	ErrMagicLinkOtherBrowser = errors.New("this sign-in link was requested from another browser, enter the code from the email there")
+)
+
+// MagicLinkService handles passwordless sign in with emailed links. Each link is bound to the
+// browser that requested it through a cookie, so a link forwarded or intercepted elsewhere
+// cannot be used; the email also carries a code to type in that browser when the link opens
+// in another one, as happens with in-app browsers.
+type MagicLinkService struct {
+	userRepo    *repository.UserRepository
+	tokenRepo   *repository.UserTokenRepository
+	mailer      mail.Mailer
+	frontendURL string
+}
+
+// NewMagicLinkService creates a new magic link service
+func NewMagicLinkService(userRepo *repository.UserRepository, tokenRepo *repository.UserTokenRepository, mailer mail.Mailer, cfg *config.Config) *MagicLinkService {
+	return &MagicLinkService{
+		userRepo:    userRepo,
+		tokenRepo:   tokenRepo,
+		mailer:      mailer,
+		frontendURL: strings.TrimRight(cfg.App.FrontendURL, "/"),
+	}
+}
+
+// RequestLink emails a sign-in link bound to a browser to the user with an email.
+// Unknown emails are ignored so callers cannot tell which emails have an account.
+func (s *MagicLinkService) RequestLink(ctx context.Context, email, binding string) error {
+	// Get user by email
+	user, err := s.userRepo.GetByEmail(email)
+	if err != nil {
+		return nil
+	}
+
+	// Only the most recent link can be used
+	if err := s.tokenRepo.InvalidateByUserID(user.ID, models.TokenPurposeMagicLink); err != nil {
+		return err
+	}
+
+	// Generate token and code, only their hashes are stored
+	token, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	if err := s.tokenRepo.Create(&models.UserToken{
+		UserID:      user.ID,
+		Purpose:     models.TokenPurposeMagicLink,
+		TokenHash:   hash,
+		BindingHash: auth.HashToken(binding),
+		CodeHash:    auth.HashToken(code),
+		ExpiresAt:   time.Now().Add(magicLinkTTL),
+		CreatedAt:   time.Now(),
+	}); err != nil {
+		return err
+	}
+
+	link := s.frontendURL + "/magic-link?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, mail.MagicLinkEmail(user.Email, user.Name, link, code))
+}
+
+// ConsumeLink signs in the user a link was sent to, if it is used in the browser that requested it
+func (s *MagicLinkService) ConsumeLink(token, binding string) (*models.User, error) {
+	// Get token
+	magicLink, err := s.tokenRepo.GetByHash(models.TokenPurposeMagicLink, auth.HashToken(token))
+	if err != nil || !magicLink.IsValid() {
+		return nil, ErrInvalidMagicLink
+	}
+
+	// The link is left usable so the user can still enter the code in the right browser
+	if binding == "" || subtle.ConstantTimeCompare([]byte(magicLink.BindingHash), []byte(auth.HashToken(binding))) != 1 {
+		return nil, ErrMagicLinkOtherBrowser
+	}
+
+	return s.consume(magicLink)
+}
+
+// ConsumeCode signs in the user whose link was requested by a browser, with the code from the email
+func (s *MagicLinkService) ConsumeCode(code, binding string) (*models.User, error) {
+	if binding == "" {
+		return nil, ErrInvalidMagicLink
+	}
+
+	// Get the token requested by this browser
+	magicLink, err := s.tokenRepo.GetByBindingHash(models.TokenPurposeMagicLink, auth.HashToken(binding))
+	if err != nil || !magicLink.IsValid() || magicLink.Attempts >= magicLinkMaxCodeAttempts {
+		return nil, ErrInvalidMagicLink
+	}
+
+	// Check code, too many wrong codes invalidate the link
+	if subtle.ConstantTimeCompare([]byte(magicLink.CodeHash), []byte(auth.HashToken(strings.TrimSpace(code)))) != 1 {
+		if err := s.tokenRepo.IncrementAttempts(magicLink.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidMagicLink
+	}
+
+	return s.consume(magicLink)
+}
+
+// consume marks a magic link as used and returns its user
+func (s *MagicLinkService) consume(magicLink *models.UserToken) (*models.User, error) {
+	// Mark the token as used, losing the race means it was already used
+	marked, err := s.tokenRepo.MarkUsed(magicLink.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !marked {
+		return nil, ErrInvalidMagicLink
+	}
+
+	// Get user
+	user, err := s.userRepo.GetByID(magicLink.UserID)
+	if err != nil {
+		return nil, ErrInvalidMagicLink
+	}
+
+	// Following the emailed link also proves the user owns the address
+	if !user.IsVerified {
+		user.IsVerified = true
+		user.UpdatedAt = time.Now()
+
+		if err := s.userRepo.Update(user); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/auth"
+	"github.com/ralfferreira/papo-reto/internal/config"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/oidc"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// OpenID Connect login errors
+var (
+	ErrUnknownProvider     = errors.New("unknown identity provider")
+	ErrInvalidLoginState   = errors.New("invalid or expired login state")
+	ErrExternalLoginFailed = errors.New("could not sign in with the identity provider")
+	ErrEmailNotVerified    = errors.New("the identity provider did not confirm the email address")
+	ErrAccountNotLinkable  = errors.New("an unverified account already uses this email, sign in with your password first")
+)
+
+// OIDCService handles sign in with external OpenID Connect providers
+type OIDCService struct {
+	providers    map[string]*oidc.Provider
+	names        []string
+	states       *oidc.StateStore
+	identityRepo *repository.UserIdentityRepository
+	userRepo     *repository.UserRepository
+}
+
+// NewOIDCService creates a new OpenID Connect service for the providers in the configuration
+func NewOIDCService(identityRepo *repository.UserIdentityRepository, userRepo *repository.UserRepository, states *oidc.StateStore, cfg *config.Config) *OIDCService {
+	service := &OIDCService{
+		providers:    make(map[string]*oidc.Provider),
+		states:       states,
+		identityRepo: identityRepo,
+		userRepo:     userRepo,
+	}
+
+	for _, providerConfig := range cfg.OIDC.Providers {
+		service.providers[providerConfig.Name] = oidc.NewProvider(providerConfig)
+		service.names = append(service.names, providerConfig.Name)
+	}
+
+	return service
+}
+
+// Providers returns the names of the configured providers
+func (s *OIDCService) Providers() []string {
+	return s.names
+}
+
+// AuthorizationURL starts a login with a provider and returns the URL to send the user to,
+// along with the binding the browser must keep to complete the login
+func (s *OIDCService) AuthorizationURL(ctx context.Context, providerName string) (string, string, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+
+	// Generate state, nonce and PKCE verifier
+	state, err := oidc.RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	codeVerifier, err := oidc.RandomString()
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := s.states.Save(ctx, state, &oidc.LoginState{
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+	}); err != nil {
+		return "", "", err
+	}
+
+	authorizationURL, err := provider.AuthCodeURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	return authorizationURL, auth.HashToken(state), nil
+}
+
+// Authenticate completes a login with a provider and returns the user it signs in.
+// The binding must be the one returned with the authorization URL, so a login started
+// in one browser cannot be completed in another.
+// Identities are linked to the user with the same email when the provider vouches for it,
+// otherwise a new user is created.
+func (s *OIDCService) Authenticate(ctx context.Context, providerName, code, state, binding string) (*models.User, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	// Check binding before taking the state, so a forged callback does not use up the real one
+	if binding == "" || subtle.ConstantTimeCompare([]byte(binding), []byte(auth.HashToken(state))) != 1 {
+		return nil, ErrInvalidLoginState
+	}
+
+	// Check state, it was issued for this provider
+	loginState, err := s.states.Take(ctx, state)
+	if err != nil {
+		if errors.Is(err, oidc.ErrStateNotFound) {
+			return nil, ErrInvalidLoginState
+		}
+		return nil, err
+	}
+
+	if loginState.Provider != providerName {
+		return nil, ErrInvalidLoginState
+	}
+
+	return s.signIn(ctx, provider, code, loginState)
+}
+
+// signIn exchanges the code of a login with a provider and returns the user it signs in
+func (s *OIDCService) signIn(ctx context.Context, provider *oidc.Provider, code string, loginState *oidc.LoginState) (*models.User, error) {
+	providerName := provider.Name()
+
+	// Exchange code and verify ID token
+	idToken, err := provider.Exchange(ctx, code, loginState.CodeVerifier)
+	if err != nil {
+		log.Printf("Failed to exchange %s authorization code: %v", providerName, err)
+		return nil, ErrExternalLoginFailed
+	}
+
+	claims, err := provider.VerifyIDToken(ctx, idToken, loginState.Nonce)
+	if err != nil {
+		log.Printf("Failed to verify %s ID token: %v", providerName, err)
+		return nil, ErrExternalLoginFailed
+	}
+
+	// Known identity
+	identity, err := s.identityRepo.GetByProviderSubject(providerName, claims.Subject)
+	if err == nil {
+		return &identity.User, nil
+	}
+
+	// Unverified emails could belong to anyone, they are neither linked nor used for new accounts
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	user, err := s.userRepo.GetByEmail(claims.Email)
+	if err == nil {
+		// Whoever registered an unverified account may not own the email, linking would hand it to them
+		if !user.IsVerified {
+			return nil, ErrAccountNotLinkable
+		}
+	} else {
+		user, err = s.createUser(claims)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Link identity
+	if err := s.identityRepo.Create(&models.UserIdentity{
+		UserID:    user.ID,
+		Provider:  providerName,
+		Subject:   claims.Subject,
+		Email:     claims.Email,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// GetIdentities returns the external identities linked to a user
+func (s *OIDCService) GetIdentities(userID uuid.UUID) ([]models.UserIdentity, error) {
+	return s.identityRepo.GetByUserID(userID)
+}
+
+// createUser creates a verified user for an external identity. The user gets a random
+// password nobody knows, they can set one through a password reset.
+func (s *OIDCService) createUser(claims *oidc.IDTokenClaims) (*models.User, error) {
+	password, _, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	// Names are limited to 100 characters, cut on a rune boundary
+	name := claims.Name
+	if utf8.RuneCountInString(name) > 100 {
+		name = string([]rune(name)[:100])
+	}
+
+	user := &models.User{
+		Email:        claims.Email,
+		Password:     string(hashedPassword),
+		Name:         name,
+		IsVerified:   true,
+		Plan:         "free",
+		MessageCount: 0,
+		ActiveGroups: 0,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	if err := s.userRepo.Create(user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/ralfferreira/papo-reto/internal/auth"
+	"github.com/ralfferreira/papo-reto/internal/config"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/oidc"
+	"github.com/ralfferreira/papo-reto/internal/oidc/oidctest"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+	"github.com/ralfferreira/papo-reto/internal/testdb"
+	"gorm.io/gorm"
+)
+
+// oidcFixture is an OpenID Connect service signing in with a mock provider
+type oidcFixture struct {
+	db      *gorm.DB
+	mock    *oidctest.Provider
+	service *OIDCService
+}
+
+func newOIDCFixture(t *testing.T) *oidcFixture {
+	t.Helper()
+
+	db := testdb.New(t, &models.User{}, &models.UserIdentity{})
+	mock := oidctest.NewProvider(t)
+
+	// Login states are never reached in these tests, the Redis is unreachable
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", DialTimeout: 10 * time.Millisecond, MaxRetries: -1})
+	t.Cleanup(func() { rdb.Close() })
+
+	cfg := &config.Config{OIDC: config.OIDCConfig{Providers: []config.OIDCProviderConfig{mock.Config("test")}}}
+
+	return &oidcFixture{
+		db:   db,
+		mock: mock,
+		service: NewOIDCService(
+			repository.NewUserIdentityRepository(db),
+			repository.NewUserRepository(db),
+			oidc.NewStateStore(rdb, time.Minute),
+			cfg,
+		),
+	}
+}
+
+// signIn completes a login with the mock provider past the state check, as the user described by login
+func (f *oidcFixture) signIn(t *testing.T, login oidctest.Login) (*models.User, error) {
+	t.Helper()
+
+	ctx := context.Background()
+	provider := f.service.providers["test"]
+	loginState := &oidc.LoginState{Provider: "test", Nonce: "nonce", CodeVerifier: "verifier"}
+
+	authorizationURL, err := provider.AuthCodeURL(ctx, "state", loginState.Nonce, loginState.CodeVerifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+
+	code := f.mock.Authorize(t, authorizationURL, login)
+	return f.service.signIn(ctx, provider, code, loginState)
+}
+
+// createUser creates a local account
+func (f *oidcFixture) createUser(t *testing.T, email string, verified bool) *models.User {
+	t.Helper()
+
+	user := &models.User{Email: email, Password: "hash", Name: "Local", IsVerified: verified, Plan: "free"}
+	testdb.Create(t, f.db, user)
+	return user
+}
+
+// identityCount returns the number of linked identities
+func (f *oidcFixture) identityCount(t *testing.T) int64 {
+	t.Helper()
+
+	var count int64
+	if err := f.db.Model(&models.UserIdentity{}).Count(&count).Error; err != nil {
+		t.Fatalf("failed to count identities: %v", err)
+	}
+	return count
+}
+
+func TestOIDCAuthenticateRequiresBinding(t *testing.T) {
+	f := newOIDCFixture(t)
+	state := "state"
+
+	tests := []struct {
+		name    string
+		binding string
+	}{
+		{"no cookie", ""},
+		{"another state", auth.HashToken("another-state")},
+		{"raw state", state},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := f.service.Authenticate(context.Background(), "test", "code", state, tt.binding)
+			if !errors.Is(err, ErrInvalidLoginState) {
+				t.Errorf("Authenticate() error = %v, want %v", err, ErrInvalidLoginState)
+			}
+		})
+	}
+}
+
+func TestOIDCAuthenticateUnknownProvider(t *testing.T) {
+	f := newOIDCFixture(t)
+
+	if _, err := f.service.Authenticate(context.Background(), "other", "code", "state", auth.HashToken("state")); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("Authenticate() error = %v, want %v", err, ErrUnknownProvider)
+	}
+}
+
+func TestOIDCSignInRejectsInvalidIDTokens(t *testing.T) {
+	tests := []struct {
+		name  string
+		login oidctest.Login
+	}{
+		{"nonce mismatch", oidctest.Login{Subject: "123", Email: "ana@example.com", EmailVerified: true, Nonce: "another-nonce"}},
+		{"bad signature", oidctest.Login{Subject: "123", Email: "ana@example.com", EmailVerified: true, Forged: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOIDCFixture(t)
+
+			if _, err := f.signIn(t, tt.login); !errors.Is(err, ErrExternalLoginFailed) {
+				t.Errorf("signIn() error = %v, want %v", err, ErrExternalLoginFailed)
+			}
+			if count := f.identityCount(t); count != 0 {
+				t.Errorf("%d identities were linked", count)
+			}
+		})
+	}
+}
+
+func TestOIDCSignInLinksVerifiedEmail(t *testing.T) {
+	f := newOIDCFixture(t)
+	local := f.createUser(t, "ana@example.com", true)
+
+	user, err := f.signIn(t, oidctest.Login{Subject: "123", Email: "ana@example.com", EmailVerified: true, Name: "Ana"})
+	if err != nil {
+		t.Fatalf("signIn: %v", err)
+	}
+	if user.ID != local.ID {
+		t.Errorf("signed in user %s, want the local account %s", user.ID, local.ID)
+	}
+
+	// The identity is known from now on, even if the provider reports another email
+	user, err = f.signIn(t, oidctest.Login{Subject: "123", Email: "ana@outro.com", EmailVerified: true})
+	if err != nil {
+		t.Fatalf("signIn: %v", err)
+	}
+	if user.ID != local.ID {
+		t.Errorf("signed in user %s, want the linked account %s", user.ID, local.ID)
+	}
+	if count := f.identityCount(t); count != 1 {
+		t.Errorf("identity count = %d, want 1", count)
+	}
+}
+
+func TestOIDCSignInRefusesUnverifiedEmails(t *testing.T) {
+	tests := []struct {
+		name          string
+		localVerified *bool
+		emailVerified bool
+		want          error
+	}{
+		{"provider did not verify the email", nil, false, ErrEmailNotVerified},
+		{"provider did not verify the email of a local account", boolPtr(true), false, ErrEmailNotVerified},
+		{"local account is not verified", boolPtr(false), true, ErrAccountNotLinkable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOIDCFixture(t)
+			if tt.localVerified != nil {
+				f.createUser(t, "ana@example.com", *tt.localVerified)
+			}
+
+			if _, err := f.signIn(t, oidctest.Login{Subject: "123", Email: "ana@example.com", EmailVerified: tt.emailVerified}); !errors.Is(err, tt.want) {
+				t.Fatalf("signIn() error = %v, want %v", err, tt.want)
+			}
+
+			if count := f.identityCount(t); count != 0 {
+				t.Errorf("%d identities were linked", count)
+			}
+
+			// No account is created for the email either
+			wantUsers := int64(0)
+			if tt.localVerified != nil {
+				wantUsers = 1
+			}
+			var users int64
+			if err := f.db.Model(&models.User{}).Count(&users).Error; err != nil {
+				t.Fatalf("failed to count users: %v", err)
+			}
+			if users != wantUsers {
+				t.Errorf("user count = %d, want %d", users, wantUsers)
+			}
+		})
+	}
+}
+
+func TestOIDCSignInCreatesVerifiedUser(t *testing.T) {
+	f := newOIDCFixture(t)
+
+	// A name over the limit is cut without splitting the accented letters
+	name := strings.Repeat("é", 150)
+	user, err := f.signIn(t, oidctest.Login{Subject: "123", Email: "novo@example.com", EmailVerified: true, Name: name})
+	if err != nil {
+		t.Fatalf("signIn: %v", err)
+	}
+
+	if !user.IsVerified || user.Email != "novo@example.com" {
+		t.Errorf("unexpected user: %+v", user)
+	}
+	if !utf8.ValidString(user.Name) || utf8.RuneCountInString(user.Name) != 100 {
+		t.Errorf("name = %q, want 100 whole characters", user.Name)
+	}
+	if count := f.identityCount(t); count != 1 {
+		t.Errorf("identity count = %d, want 1", count)
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
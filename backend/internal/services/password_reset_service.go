@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ralfferreira/papo-reto/internal/auth"
+	"github.com/ralfferreira/papo-reto/internal/config"
+	"github.com/ralfferreira/papo-reto/internal/mail"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordResetTokenTTL is how long password reset links are valid
+const passwordResetTokenTTL = time.Hour
+
+// ErrInvalidResetToken is returned when a password reset token cannot be used
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// PasswordResetService handles password resets for users who forgot their password
+type PasswordResetService struct {
+	userRepo       *repository.UserRepository
+	tokenRepo      *repository.UserTokenRepository
+	sessionService *SessionService
+	mailer         mail.Mailer
+	frontendURL    string
+}
+
+// NewPasswordResetService creates a new password reset service
+func NewPasswordResetService(userRepo *repository.UserRepository, tokenRepo *repository.UserTokenRepository, sessionService *SessionService, mailer mail.Mailer, cfg *config.Config) *PasswordResetService {
+	return &PasswordResetService{
+		userRepo:       userRepo,
+		tokenRepo:      tokenRepo,
+		sessionService: sessionService,
+		mailer:         mailer,
+		frontendURL:    strings.TrimRight(cfg.App.FrontendURL, "/"),
+	}
+}
+
+// RequestReset emails a password reset link to the user with an email.
+// Unknown emails are ignored so callers cannot tell which emails have an account.
+func (s *PasswordResetService) RequestReset(ctx context.Context, email string) error {
+	// Get user by email
+	user, err := s.userRepo.GetByEmail(email)
+	if err != nil {
+		return nil
+	}
+
+	// Only the most recent link can be used
+	if err := s.tokenRepo.InvalidateByUserID(user.ID, models.TokenPurposePasswordReset); err != nil {
+		return err
+	}
+
+	// Generate token, only its hash is stored
+	token, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	if err := s.tokenRepo.Create(&models.UserToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenPurposePasswordReset,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(passwordResetTokenTTL),
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return err
+	}
+
+	link := s.frontendURL + "/reset-password?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, mail.PasswordResetEmail(user.Email, user.Name, link))
+}
+
+// ResetPassword sets a new password for the user a reset token was issued to and signs them out everywhere
+func (s *PasswordResetService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	// Get token
+	resetToken, err := s.tokenRepo.GetByHash(models.TokenPurposePasswordReset, auth.HashToken(token))
+	if err != nil || !resetToken.IsValid() {
+		return ErrInvalidResetToken
+	}
+
+	// Mark the token as used, losing the race means it was already used
+	marked, err := s.tokenRepo.MarkUsed(resetToken.ID)
+	if err != nil {
+		return err
+	}
+
+	if !marked {
+		return ErrInvalidResetToken
+	}
+
+	// Get user
+	user, err := s.userRepo.GetByID(resetToken.UserID)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+
+	// Hash new password
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	// Update user, following the emailed link also proves the user owns the address
+	user.Password = string(hashedPassword)
+	user.IsVerified = true
+	user.UpdatedAt = time.Now()
+
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	// Sign out every session, one of them may belong to whoever knew the old password
+	if err := s.sessionService.RevokeAllSessions(ctx, user.ID); err != nil {
+		return err
+	}
+
+	// Notify the user
+	if err := s.mailer.Send(ctx, mail.PasswordChangedEmail(user.Email, user.Name)); err != nil {
+		log.Printf("Failed to send password changed email: %v", err)
+	}
+
+	return nil
+}
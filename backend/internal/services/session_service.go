@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/auth"
+	"github.com/ralfferreira/papo-reto/internal/config"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+)
+
+// Session errors
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrSessionRevoked      = errors.New("session has been revoked")
+	ErrSessionNotFound     = errors.New("session not found")
+)
+
+// TokenPair holds the tokens issued to a session
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+}
+
+// SessionService handles business logic for sessions and their tokens
+type SessionService struct {
+	sessionRepo   *repository.SessionRepository
+	userRepo      *repository.UserRepository
+	jwtService    *auth.JWTService
+	cache         *auth.SessionCache
+	refreshExpiry time.Duration
+}
+
+// NewSessionService creates a new session service
+func NewSessionService(sessionRepo *repository.SessionRepository, userRepo *repository.UserRepository, jwtService *auth.JWTService, cache *auth.SessionCache, cfg *config.Config) *SessionService {
+	return &SessionService{
+		sessionRepo:   sessionRepo,
+		userRepo:      userRepo,
+		jwtService:    jwtService,
+		cache:         cache,
+		refreshExpiry: time.Duration(cfg.JWT.RefreshExpiryDays) * 24 * time.Hour,
+	}
+}
+
+// CreateSession starts a new session for a user on a client and issues its first tokens
+func (s *SessionService) CreateSession(user *models.User, client ClientInfo) (*TokenPair, error) {
+	// Create session
+	session := &models.Session{
+		UserID:      user.ID,
+		UserAgent:   truncateRunes(client.UserAgent, 255),
+		IPAddress:   client.TruncatedIP(),
+		DeviceLabel: client.DeviceLabel(),
+		LastSeenAt:  time.Now(),
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(user, session.ID)
+}
+
+// Refresh exchanges a refresh token for a new token pair. Refresh tokens are single use:
+// presenting one that was already exchanged revokes the whole session, since either the
+// client or an attacker holds a stolen copy.
+func (s *SessionService) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	// Get refresh token
+	token, err := s.sessionRepo.GetRefreshTokenByHash(auth.HashToken(refreshToken))
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if token.Session.IsRevoked() || token.IsExpired() {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Mark the token as used, losing the race means it was reused
+	marked, err := s.sessionRepo.MarkRefreshTokenUsed(token.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !marked {
+		log.Printf("Refresh token reuse detected, revoking session %s", token.SessionID)
+		if err := s.RevokeSession(ctx, token.SessionID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Get user
+	user, err := s.userRepo.GetByID(token.Session.UserID)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return s.issueTokens(user, token.SessionID)
+}
+
+// CheckSession checks that the session an access token belongs to has not been revoked.
+// The state is cached in Redis, the database is only read, and the last use of the session
+// recorded, when the cache has expired or Redis is unavailable.
+func (s *SessionService) CheckSession(ctx context.Context, sessionID uuid.UUID) error {
+	state, err := s.cache.State(ctx, sessionID)
+	if err != nil {
+		log.Printf("Failed to get cached session state: %v", err)
+	}
+
+	switch state {
+	case auth.SessionStateActive:
+		return nil
+	case auth.SessionStateRevoked:
+		return ErrSessionRevoked
+	}
+
+	// Get session
+	session, err := s.sessionRepo.GetByID(sessionID)
+	if err != nil {
+		return err
+	}
+
+	if session.IsRevoked() {
+		if err := s.cache.MarkRevoked(ctx, sessionID); err != nil {
+			log.Printf("Failed to cache session state: %v", err)
+		}
+		return ErrSessionRevoked
+	}
+
+	if err := s.sessionRepo.TouchLastSeen(sessionID, time.Now()); err != nil {
+		log.Printf("Failed to record session use: %v", err)
+	}
+
+	if err := s.cache.MarkActive(ctx, sessionID); err != nil {
+		log.Printf("Failed to cache session state: %v", err)
+	}
+
+	return nil
+}
+
+// GetSessions returns the sessions of a user that are still usable, most recently used first
+func (s *SessionService) GetSessions(userID uuid.UUID) ([]models.Session, error) {
+	return s.sessionRepo.GetActiveByUserID(userID, time.Now().Add(-s.refreshExpiry))
+}
+
+// RevokeUserSession revokes a session of a user, such as one on a lost device
+func (s *SessionService) RevokeUserSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	// Get session, sessions of other users are reported as not found
+	session, err := s.sessionRepo.GetByID(sessionID)
+	if err != nil || session.UserID != userID || session.IsRevoked() {
+		return ErrSessionNotFound
+	}
+
+	return s.RevokeSession(ctx, sessionID)
+}
+
+// RevokeSession revokes a session, its refresh tokens and access tokens stop being accepted
+func (s *SessionService) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	if err := s.sessionRepo.Revoke(sessionID); err != nil {
+		return err
+	}
+
+	return s.cache.MarkRevoked(ctx, sessionID)
+}
+
+// RevokeAllSessions revokes every session of a user
+func (s *SessionService) RevokeAllSessions(ctx context.Context, userID uuid.UUID) error {
+	// Get active sessions
+	sessionIDs, err := s.sessionRepo.GetActiveIDsByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.sessionRepo.RevokeByIDs(sessionIDs); err != nil {
+		return err
+	}
+
+	return s.cache.MarkRevoked(ctx, sessionIDs...)
+}
+
+// issueTokens signs an access token and creates a refresh token for a session
+func (s *SessionService) issueTokens(user *models.User, sessionID uuid.UUID) (*TokenPair, error) {
+	// Generate access token
+	accessToken, err := s.jwtService.GenerateToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate refresh token, only its hash is stored
+	refreshToken, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.sessionRepo.CreateRefreshToken(&models.RefreshToken{
+		SessionID: sessionID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(s.refreshExpiry),
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    s.jwtService.AccessTokenExpiry(),
+	}, nil
+}
+
+// truncateRunes cuts s to at most n runes
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/ralfferreira/papo-reto/internal/auth"
+	"github.com/ralfferreira/papo-reto/internal/config"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+	"github.com/ralfferreira/papo-reto/internal/testdb"
+)
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	db := testdb.New(t, &models.User{}, &models.Session{}, &models.RefreshToken{})
+
+	user := &models.User{Email: "ana@example.com", Password: "hash", Name: "Ana", Plan: "free"}
+	testdb.Create(t, db, user)
+
+	cfg := &config.Config{JWT: config.JWTConfig{ExpiryMinutes: 15, RefreshExpiryDays: 30}}
+	jwtService, err := auth.NewJWTService(cfg)
+	if err != nil {
+		t.Fatalf("NewJWTService: %v", err)
+	}
+
+	// The Redis of the tests is unreachable, revoking still reaches the database
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", DialTimeout: 10 * time.Millisecond, MaxRetries: -1})
+	t.Cleanup(func() { rdb.Close() })
+
+	sessionRepo := repository.NewSessionRepository(db)
+	service := NewSessionService(sessionRepo, repository.NewUserRepository(db), jwtService, auth.NewSessionCache(rdb, time.Hour, time.Minute), cfg)
+	ctx := context.Background()
+
+	first, err := service.CreateSession(user, ClientInfo{})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	second, err := service.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	// Presenting the exchanged token again revokes the session it belongs to
+	if _, err := service.Refresh(ctx, first.RefreshToken); err == nil {
+		t.Fatal("a refresh token was exchanged twice")
+	}
+
+	var session models.Session
+	if err := db.First(&session, "user_id = ?", user.ID).Error; err != nil {
+		t.Fatalf("failed to get session: %v", err)
+	}
+	if !session.IsRevoked() {
+		t.Error("session was not revoked after its refresh token was reused")
+	}
+
+	// So the token the legitimate client or the attacker got from the first exchange is worthless too
+	if _, err := service.Refresh(ctx, second.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh() of the latest token error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
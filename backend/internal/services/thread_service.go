@@ -0,0 +1,229 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/auth"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/moderation"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+)
+
+// threadMaxReplies is the number of replies a thread can hold
+const threadMaxReplies = 100
+
+// Thread errors
+var (
+	ErrThreadNotFound  = errors.New("conversation not found")
+	ErrThreadClosed    = errors.New("this conversation is closed")
+	ErrThreadFull      = errors.New("this conversation has reached its reply limit")
+	ErrReplyNotAllowed = errors.New("reply contains content that is not allowed in this group")
+	ErrMessageNotReady = errors.New("only approved messages can be replied to")
+	ErrAlreadyRevealed = errors.New("the sender of this message is already revealed")
+	ErrNotSender       = errors.New("only the signed in user who sent this message can reveal themselves as its sender")
+)
+
+// ThreadService handles the conversations between a group and the anonymous senders of its
+// messages. Senders follow their thread with the receipt token they got when sending the
+// message, so they never need an account; only the token's hash is stored.
+type ThreadService struct {
+	messageRepo *repository.MessageRepository
+	replyRepo   *repository.ThreadReplyRepository
+	userRepo    *repository.UserRepository
+	policy      *AccessPolicy
+}
+
+// NewThreadService creates a new thread service
+func NewThreadService(messageRepo *repository.MessageRepository, replyRepo *repository.ThreadReplyRepository, userRepo *repository.UserRepository, policy *AccessPolicy) *ThreadService {
+	return &ThreadService{
+		messageRepo: messageRepo,
+		replyRepo:   replyRepo,
+		userRepo:    userRepo,
+		policy:      policy,
+	}
+}
+
+// IsThreadOpenToSender checks if the sender of a message loaded with its group can still follow up.
+// Closed threads and archived groups take no follow-ups, and neither do messages that were not
+// approved: follow-ups have no review queue, so they would reach the group before the message.
+func IsThreadOpenToSender(message *models.Message) bool {
+	return !message.IsThreadClosed() && !message.Group.IsArchived && message.ModerationStatus == models.ModerationStatusApproved
+}
+
+// GetSenderThread gets the message a receipt token was issued for and the replies of its thread
+func (s *ThreadService) GetSenderThread(token string) (*models.Message, []models.ThreadReply, error) {
+	message, err := s.messageRepo.GetByReceiptTokenHash(auth.HashToken(token))
+	if err != nil {
+		return nil, nil, ErrThreadNotFound
+	}
+
+	replies, err := s.replyRepo.GetByMessageID(message.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return message, replies, nil
+}
+
+// ReplyAsSender adds a follow-up of the anonymous sender to the thread of a receipt token
+func (s *ThreadService) ReplyAsSender(token, content string) (*models.Message, *models.ThreadReply, error) {
+	message, err := s.messageRepo.GetByReceiptTokenHash(auth.HashToken(token))
+	if err != nil {
+		return nil, nil, ErrThreadNotFound
+	}
+
+	if message.ModerationStatus == models.ModerationStatusPending {
+		return nil, nil, ErrMessageNotReady
+	}
+	if !IsThreadOpenToSender(message) {
+		return nil, nil, ErrThreadClosed
+	}
+
+	// Follow-ups go through the group's content moderation, there is no queue for them
+	pipeline, err := moderation.ForGroup(&message.Group)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := pipeline.Run(content)
+	switch result.Action {
+	case moderation.ActionReject, moderation.ActionQuarantine:
+		return nil, nil, ErrReplyNotAllowed
+	case moderation.ActionMask:
+		content = result.Content
+	}
+
+	reply, err := s.addReply(message, models.ThreadAuthorSender, nil, content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return message, reply, nil
+}
+
+// RevealSender reveals the signed in user as the sender of the message a receipt token was issued for.
+// The token alone is not enough, the user must be the one who was signed in when the message was sent.
+func (s *ThreadService) RevealSender(token string, userID uuid.UUID) (*models.Message, error) {
+	message, err := s.messageRepo.GetByReceiptTokenHash(auth.HashToken(token))
+	if err != nil {
+		return nil, ErrThreadNotFound
+	}
+
+	if message.SenderUserID == nil || *message.SenderUserID != userID {
+		return nil, ErrNotSender
+	}
+	if message.IsRevealed {
+		return nil, ErrAlreadyRevealed
+	}
+
+	// Get user
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only one request can reveal the message
+	revealed, err := s.messageRepo.RevealIdentity(message.ID, user.ID, user.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !revealed {
+		return nil, ErrAlreadyRevealed
+	}
+	message.RevealIdentity(user)
+
+	return message, nil
+}
+
+// GetThread gets a message and the replies of its thread for a member of its group
+func (s *ThreadService) GetThread(messageID, userID uuid.UUID) (*models.Message, []models.ThreadReply, error) {
+	message, err := s.policy.AuthorizeMessage(messageID, userID, ActionViewMessages)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Messages held by moderation are only visible to those who moderate them
+	if message.ModerationStatus != models.ModerationStatusApproved {
+		if _, err := s.policy.Authorize(message.GroupID, userID, ActionModerateMessages); err != nil {
+			return nil, nil, ErrMessageNotFound
+		}
+	}
+
+	replies, err := s.replyRepo.GetByMessageID(message.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return message, replies, nil
+}
+
+// ReplyAsMember adds a reply of a group member to the thread of a message
+func (s *ThreadService) ReplyAsMember(messageID, userID uuid.UUID, content string) (*models.Message, *models.ThreadReply, error) {
+	message, err := s.policy.AuthorizeMessage(messageID, userID, ActionAnswerMessages)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if message.ModerationStatus != models.ModerationStatusApproved {
+		return nil, nil, ErrMessageNotReady
+	}
+	if message.IsThreadClosed() {
+		return nil, nil, ErrThreadClosed
+	}
+
+	reply, err := s.addReply(message, models.ThreadAuthorOwner, &userID, content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return message, reply, nil
+}
+
+// CloseThread stops the thread of a message from taking replies
+func (s *ThreadService) CloseThread(messageID, userID uuid.UUID) (*models.Message, error) {
+	message, err := s.policy.AuthorizeMessage(messageID, userID, ActionAnswerMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	if message.IsThreadClosed() {
+		return nil, ErrThreadClosed
+	}
+
+	// Only one request can close the thread, and nothing else on the message is written
+	now := time.Now()
+	closed, err := s.messageRepo.CloseThread(message.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !closed {
+		return nil, ErrThreadClosed
+	}
+	message.ThreadClosedAt = &now
+
+	return message, nil
+}
+
+// addReply adds a reply to the thread of a message if the thread has room for it
+func (s *ThreadService) addReply(message *models.Message, authorType string, authorID *uuid.UUID, content string) (*models.ThreadReply, error) {
+	reply := &models.ThreadReply{
+		MessageID:  message.ID,
+		AuthorType: authorType,
+		AuthorID:   authorID,
+		Content:    strings.TrimSpace(content),
+		CreatedAt:  time.Now(),
+	}
+
+	created, err := s.replyRepo.CreateWithinLimit(reply, threadMaxReplies)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, ErrThreadFull
+	}
+
+	return reply, nil
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/auth"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+	"github.com/ralfferreira/papo-reto/internal/testdb"
+	"gorm.io/gorm"
+)
+
+// newThreadFixture creates a thread service and a message of a group with its receipt token
+func newThreadFixture(t *testing.T, status string) (*gorm.DB, *ThreadService, *models.Message, string) {
+	t.Helper()
+
+	db := testdb.New(t)
+	group := testdb.Group(t, db, uuid.New(), "grupo")
+
+	token, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	message := &models.Message{GroupID: group.ID, Content: "oi", ModerationStatus: status, ReceiptTokenHash: hash}
+	testdb.Create(t, db, message)
+
+	service := NewThreadService(repository.NewMessageRepository(db), repository.NewThreadReplyRepository(db), repository.NewUserRepository(db), newTestPolicy(db))
+
+	return db, service, message, token
+}
+
+func TestReplyAsSenderRequiresApprovedMessage(t *testing.T) {
+	tests := []struct {
+		status string
+		want   error
+	}{
+		{models.ModerationStatusApproved, nil},
+		{models.ModerationStatusPending, ErrMessageNotReady},
+		{models.ModerationStatusRejected, ErrThreadClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			_, service, _, token := newThreadFixture(t, tt.status)
+
+			if _, _, err := service.ReplyAsSender(token, "e aí?"); !errors.Is(err, tt.want) {
+				t.Errorf("ReplyAsSender() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetThreadHidesHeldMessagesFromViewers(t *testing.T) {
+	tests := []struct {
+		status string
+		role   string
+		want   error
+	}{
+		{models.ModerationStatusApproved, models.RoleViewer, nil},
+		{models.ModerationStatusPending, models.RoleViewer, ErrMessageNotFound},
+		{models.ModerationStatusRejected, models.RoleViewer, ErrMessageNotFound},
+		{models.ModerationStatusPending, models.RoleModerator, nil},
+		{models.ModerationStatusRejected, models.RoleModerator, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status+" "+tt.role, func(t *testing.T) {
+			db, service, message, _ := newThreadFixture(t, tt.status)
+
+			member := uuid.New()
+			testdb.Create(t, db, &models.SharedAccess{GroupID: message.GroupID, Token: uuid.NewString(), Role: tt.role, IsActive: true, UserID: &member})
+
+			if _, _, err := service.GetThread(message.ID, member); !errors.Is(err, tt.want) {
+				t.Errorf("GetThread() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplyAsSenderThreadLimit(t *testing.T) {
+	db, service, message, token := newThreadFixture(t, models.ModerationStatusApproved)
+
+	for i := 0; i < threadMaxReplies; i++ {
+		testdb.Create(t, db, &models.ThreadReply{MessageID: message.ID, AuthorType: models.ThreadAuthorSender, Content: "oi"})
+	}
+
+	if _, _, err := service.ReplyAsSender(token, "mais uma"); !errors.Is(err, ErrThreadFull) {
+		t.Fatalf("ReplyAsSender() error = %v, want %v", err, ErrThreadFull)
+	}
+
+	var count int64
+	if err := db.Model(&models.ThreadReply{}).Where("message_id = ?", message.ID).Count(&count).Error; err != nil {
+		t.Fatalf("failed to count replies: %v", err)
+	}
+	if count != threadMaxReplies {
+		t.Errorf("reply count = %d, want %d", count, threadMaxReplies)
+	}
+}
+
+func TestRevealSender(t *testing.T) {
+	db, service, message, token := newThreadFixture(t, models.ModerationStatusApproved)
+
+	sender := &models.User{Email: "remetente@example.com", Password: "hash", Name: "Remetente", Plan: "free"}
+	other := &models.User{Email: "outro@example.com", Password: "hash", Name: "Outro", Plan: "free"}
+	testdb.Create(t, db, sender, other)
+	if err := db.Model(message).Update("sender_user_id", sender.ID).Error; err != nil {
+		t.Fatalf("failed to set sender: %v", err)
+	}
+
+	// Someone else holding the receipt token cannot reveal as the sender
+	if _, err := service.RevealSender(token, other.ID); !errors.Is(err, ErrNotSender) {
+		t.Fatalf("RevealSender() by another user error = %v, want %v", err, ErrNotSender)
+	}
+
+	revealed, err := service.RevealSender(token, sender.ID)
+	if err != nil {
+		t.Fatalf("RevealSender: %v", err)
+	}
+	if !revealed.IsRevealed || revealed.SenderName != "Remetente" {
+		t.Errorf("unexpected revealed message: %+v", revealed)
+	}
+
+	if _, err := service.RevealSender(token, sender.ID); !errors.Is(err, ErrAlreadyRevealed) {
+		t.Errorf("second RevealSender() error = %v, want %v", err, ErrAlreadyRevealed)
+	}
+
+	var stored models.Message
+	if err := db.First(&stored, "id = ?", message.ID).Error; err != nil {
+		t.Fatalf("failed to get message: %v", err)
+	}
+	if stored.SenderID == nil || *stored.SenderID != sender.ID.String() {
+		t.Errorf("SenderID = %v, want %s", stored.SenderID, sender.ID)
+	}
+}
+
+func TestRevealSenderOfAnonymousMessage(t *testing.T) {
+	db, service, _, token := newThreadFixture(t, models.ModerationStatusApproved)
+
+	user := &models.User{Email: "alguem@example.com", Password: "hash", Name: "Alguém", Plan: "free"}
+	testdb.Create(t, db, user)
+
+	// Messages sent without signing in have no sender to reveal
+	if _, err := service.RevealSender(token, user.ID); !errors.Is(err, ErrNotSender) {
+		t.Errorf("RevealSender() error = %v, want %v", err, ErrNotSender)
+	}
+}
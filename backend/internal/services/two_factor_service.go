@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/auth"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// totpIssuer is the account issuer shown by authenticator apps
+	totpIssuer = "Papo Reto"
+
+	// recoveryCodeCount is the number of recovery codes issued at a time
+	recoveryCodeCount = 10
+)
+
+// Two-factor authentication errors
+var (
+	ErrInvalidTwoFactorCode     = errors.New("invalid two-factor code")
+	ErrInvalidChallenge         = errors.New("invalid or expired two-factor challenge")
+	ErrInvalidPassword          = errors.New("password is incorrect")
+	ErrTwoFactorEnabled         = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled      = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorSetupNotStarted = errors.New("two-factor authentication setup has not been started")
+)
+
+// TOTPSetup holds what a user needs to add their account to an authenticator app
+type TOTPSetup struct {
+	Secret string
+	URI    string
+}
+
+// TwoFactorChallenge is a pending second login step and the user it was issued to
+type TwoFactorChallenge struct {
+	Token string
+	User  *models.User
+}
+
+// TwoFactorService handles TOTP two-factor authentication
+type TwoFactorService struct {
+	userRepo         *repository.UserRepository
+	recoveryCodeRepo *repository.RecoveryCodeRepository
+	challenges       *auth.ChallengeStore
+}
+
+// NewTwoFactorService creates a new two-factor service
+func NewTwoFactorService(userRepo *repository.UserRepository, recoveryCodeRepo *repository.RecoveryCodeRepository, challenges *auth.ChallengeStore) *TwoFactorService {
+	return &TwoFactorService{
+		userRepo:         userRepo,
+		recoveryCodeRepo: recoveryCodeRepo,
+		challenges:       challenges,
+	}
+}
+
+// BeginSetup generates a new TOTP secret for a user, it is not used until confirmed with Enable
+func (s *TwoFactorService) BeginSetup(userID uuid.UUID) (*TOTPSetup, error) {
+	// Get user
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	// Generate secret
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	// Update user
+	user.TOTPSecret = secret
+	user.TOTPLastCounter = 0
+	user.UpdatedAt = time.Now()
+
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+
+	return &TOTPSetup{
+		Secret: secret,
+		URI:    auth.TOTPURI(totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// Enable confirms the enrollment with a first code and returns the user's recovery codes
+func (s *TwoFactorService) Enable(userID uuid.UUID, code string) ([]string, error) {
+	// Get user
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorSetupNotStarted
+	}
+
+	// Check code
+	if err := s.checkTOTP(user, code); err != nil {
+		return nil, err
+	}
+
+	// Generate recovery codes before enabling so the user is never left without them
+	codes, err := s.replaceRecoveryCodes(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Update user
+	user.TOTPEnabled = true
+	user.UpdatedAt = time.Now()
+
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Disable turns two-factor authentication off, the user must enter their password and a code
+func (s *TwoFactorService) Disable(userID uuid.UUID, password, code string) error {
+	user, err := s.reauthenticate(userID, password, code)
+	if err != nil {
+		return err
+	}
+
+	if err := s.recoveryCodeRepo.DeleteByUserID(user.ID); err != nil {
+		return err
+	}
+
+	// Update user
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPLastCounter = 0
+	user.UpdatedAt = time.Now()
+
+	return s.userRepo.Update(user)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of a user, the user must enter their password and a code
+func (s *TwoFactorService) RegenerateRecoveryCodes(userID uuid.UUID, password, code string) ([]string, error) {
+	user, err := s.reauthenticate(userID, password, code)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.replaceRecoveryCodes(user.ID)
+}
+
+// CreateChallenge issues the token a user exchanges for a session once they enter their code
+func (s *TwoFactorService) CreateChallenge(ctx context.Context, user *models.User) (string, error) {
+	return s.challenges.Create(ctx, user.ID)
+}
+
+// GetChallenge returns a pending challenge with the user it was issued to
+func (s *TwoFactorService) GetChallenge(ctx context.Context, token string) (*TwoFactorChallenge, error) {
+	userID, err := s.challenges.Get(ctx, token)
+	if err != nil {
+		if errors.Is(err, auth.ErrChallengeNotFound) {
+			return nil, ErrInvalidChallenge
+		}
+		return nil, err
+	}
+
+	// Get user
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil || !user.TOTPEnabled {
+		return nil, ErrInvalidChallenge
+	}
+
+	return &TwoFactorChallenge{Token: token, User: user}, nil
+}
+
+// CompleteChallenge checks the code entered for a challenge, either a TOTP code or a recovery code.
+// A challenge takes a limited number of codes and is used up once passed or out of attempts.
+func (s *TwoFactorService) CompleteChallenge(ctx context.Context, challenge *TwoFactorChallenge, code string) error {
+	// Count the attempt before checking the code so concurrent guesses are limited too
+	remaining, err := s.challenges.Attempt(ctx, challenge.Token)
+	if err != nil {
+		if errors.Is(err, auth.ErrChallengeNotFound) {
+			return ErrInvalidChallenge
+		}
+		return err
+	}
+
+	if err := s.checkCode(challenge.User, code); err != nil {
+		if remaining == 0 {
+			if err := s.challenges.Consume(ctx, challenge.Token); err != nil && !errors.Is(err, auth.ErrChallengeNotFound) {
+				return err
+			}
+		}
+		return err
+	}
+
+	// Only one request can pass a challenge
+	if err := s.challenges.Consume(ctx, challenge.Token); err != nil {
+		if errors.Is(err, auth.ErrChallengeNotFound) {
+			return ErrInvalidChallenge
+		}
+		return err
+	}
+
+	return nil
+}
+
+// reauthenticate checks the password and a code of a user with two-factor authentication enabled
+func (s *TwoFactorService) reauthenticate(userID uuid.UUID, password, code string) (*models.User, error) {
+	// Get user
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.TOTPEnabled {
+		return nil, ErrTwoFactorNotEnabled
+	}
+
+	// Check password
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return nil, ErrInvalidPassword
+	}
+
+	if err := s.checkCode(user, code); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// checkCode checks a TOTP code or, failing that, uses a recovery code
+func (s *TwoFactorService) checkCode(user *models.User, code string) error {
+	if err := s.checkTOTP(user, code); err == nil {
+		return nil
+	}
+
+	used, err := s.recoveryCodeRepo.Use(user.ID, auth.HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+// checkTOTP checks a TOTP code, each code is accepted only once
+func (s *TwoFactorService) checkTOTP(user *models.User, code string) error {
+	counter, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+
+	advanced, err := s.userRepo.AdvanceTOTPCounter(user.ID, counter)
+	if err != nil {
+		return err
+	}
+
+	if !advanced {
+		return ErrInvalidTwoFactorCode
+	}
+
+	// Keep the loaded user in sync so saving it does not roll the counter back
+	user.TOTPLastCounter = counter
+	return nil
+}
+
+// replaceRecoveryCodes generates new recovery codes for a user, only their hashes are stored
+func (s *TwoFactorService) replaceRecoveryCodes(userID uuid.UUID) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+
+		// Formatted as xxxxx-xxxxx to be easy to copy by hand
+		code := hex.EncodeToString(b)
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, auth.HashToken(code))
+	}
+
+	if err := s.recoveryCodeRepo.Replace(userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// normalizeRecoveryCode strips the separator and case from a recovery code as typed by the user
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ralfferreira/papo-reto/internal/auth"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+	"github.com/ralfferreira/papo-reto/internal/testdb"
+)
+
+func TestCheckTOTPRejectsReplayedCodes(t *testing.T) {
+	db := testdb.New(t, &models.User{}, &models.RecoveryCode{})
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	user := &models.User{Email: "ana@example.com", Password: "hash", Name: "Ana", Plan: "free", TOTPEnabled: true, TOTPSecret: secret}
+	testdb.Create(t, db, user)
+
+	// Challenges are not used to check codes
+	service := NewTwoFactorService(repository.NewUserRepository(db), repository.NewRecoveryCodeRepository(db), nil)
+
+	now := time.Now()
+	current, err := auth.TOTPCode(secret, now)
+	if err != nil {
+		t.Fatalf("TOTPCode: %v", err)
+	}
+	previous, err := auth.TOTPCode(secret, now.Add(-30*time.Second))
+	if err != nil {
+		t.Fatalf("TOTPCode: %v", err)
+	}
+
+	if err := service.checkTOTP(user, current); err != nil {
+		t.Fatalf("checkTOTP: %v", err)
+	}
+
+	// Neither the same code nor an older one within the skew is accepted again,
+	// even by a copy of the user loaded before the code was used
+	stale := *user
+	stale.TOTPLastCounter = 0
+	for _, code := range []string{current, previous} {
+		if err := service.checkTOTP(&stale, code); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Errorf("checkTOTP(%q) error = %v, want %v", code, err, ErrInvalidTwoFactorCode)
+		}
+	}
+}
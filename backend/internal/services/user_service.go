@@ -5,26 +5,48 @@ import (
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/ralfferreira/papo-reto/internal/auth"
 	"github.com/ralfferreira/papo-reto/internal/models"
 	"github.com/ralfferreira/papo-reto/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrMessageLimitReached is returned when a user's groups cannot receive more messages this month
+var ErrMessageLimitReached = errors.New("monthly message limit reached")
+
 // UserService handles business logic for users
 type UserService struct {
-	userRepo   *repository.UserRepository
-	jwtService *auth.JWTService
+	userRepo  *repository.UserRepository
+	usageRepo *repository.UsageRepository
 }
 
 // NewUserService creates a new user service
-func NewUserService(userRepo *repository.UserRepository, jwtService *auth.JWTService) *UserService {
+func NewUserService(userRepo *repository.UserRepository, usageRepo *repository.UsageRepository) *UserService {
 	return &UserService{
-		userRepo:   userRepo,
-		jwtService: jwtService,
+		userRepo:  userRepo,
+		usageRepo: usageRepo,
 	}
 }
 
+// MessageUsage holds a user's message consumption in the current month
+type MessageUsage struct {
+	Period      string
+	Used        int
+	Limit       int // -1 means unlimited
+	PeriodStart time.Time
+	ResetsAt    time.Time
+}
+
+// Remaining returns the number of messages left this month, -1 means unlimited
+func (u *MessageUsage) Remaining() int {
+	if u.Limit < 0 {
+		return -1
+	}
+	if u.Used >= u.Limit {
+		return 0
+	}
+	return u.Limit - u.Used
+}
+
 // RegisterUser registers a new user
 func (s *UserService) RegisterUser(email, password, name string) (*models.User, error) {
 	// Check if user already exists
@@ -41,15 +63,16 @@ func (s *UserService) RegisterUser(email, password, name string) (*models.User,
 
 	// Create user
 	user := &models.User{
-		Email:        email,
-		Password:     string(hashedPassword),
-		Name:         name,
-		IsVerified:   false,
-		Plan:         "free",
-		MessageCount: 0,
-		ActiveGroups: 0,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
+		Email:                email,
+		Password:             string(hashedPassword),
+		Name:                 name,
+		IsVerified:           false,
+		VerificationRequired: true,
+		Plan:                 "free",
+		MessageCount:         0,
+		ActiveGroups:         0,
+		CreatedAt:            time.Now(),
+		UpdatedAt:            time.Now(),
 	}
 
 	// Save user
@@ -60,26 +83,20 @@ func (s *UserService) RegisterUser(email, password, name string) (*models.User,
 	return user, nil
 }
 
-// LoginUser authenticates a user and returns a JWT token
-func (s *UserService) LoginUser(email, password string) (string, error) {
+// AuthenticateUser checks a user's credentials and returns the user
+func (s *UserService) AuthenticateUser(email, password string) (*models.User, error) {
 	// Get user by email
 	user, err := s.userRepo.GetByEmail(email)
 	if err != nil {
-		return "", errors.New("invalid email or password")
+		return nil, errors.New("invalid email or password")
 	}
 
 	// Check password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return "", errors.New("invalid email or password")
+		return nil, errors.New("invalid email or password")
 	}
 
-	// Generate token
-	token, err := s.jwtService.GenerateToken(user)
-	if err != nil {
-		return "", err
-	}
-
-	return token, nil
+	return user, nil
 }
 
 // GetUserByID gets a user by ID
@@ -171,16 +188,6 @@ func (s *UserService) VerifyUser(id uuid.UUID) error {
 	return s.userRepo.Update(user)
 }
 
-// DeleteUser deletes a user
-func (s *UserService) DeleteUser(id uuid.UUID) error {
-	return s.userRepo.Delete(id)
-}
-
-// RefreshToken refreshes a JWT token
-func (s *UserService) RefreshToken(token string) (string, error) {
-	return s.jwtService.RefreshToken(token)
-}
-
 // CanCreateGroup checks if a user can create a new group
 func (s *UserService) CanCreateGroup(id uuid.UUID) (bool, error) {
 	// Get user
@@ -202,23 +209,64 @@ func (s *UserService) CanCreateGroup(id uuid.UUID) (bool, error) {
 	return true, nil
 }
 
-// CanSendMessage checks if a user can send a new message
+// CanSendMessage checks if a user's groups can receive a new message this month
 func (s *UserService) CanSendMessage(id uuid.UUID) (bool, error) {
+	usage, err := s.GetMonthlyUsage(id)
+	if err != nil {
+		return false, err
+	}
+
+	return usage.Remaining() != 0, nil
+}
+
+// GetMonthlyUsage gets a user's message consumption in the current month
+func (s *UserService) GetMonthlyUsage(id uuid.UUID) (*MessageUsage, error) {
 	// Get user
 	user, err := s.userRepo.GetByID(id)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	// Premium users can send unlimited messages
-	if user.IsPremium() {
-		return true, nil
+	now := time.Now()
+	period := models.UsagePeriod(now)
+
+	used, err := s.usageRepo.GetMessageCount(id, period)
+	if err != nil {
+		return nil, err
 	}
 
-	// Check if user has reached the message limit
-	if user.MessageCount >= user.GetMessageLimit() {
-		return false, nil
+	periodStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	return &MessageUsage{
+		Period:      period,
+		Used:        used,
+		Limit:       user.GetMessageLimit(),
+		PeriodStart: periodStart,
+		ResetsAt:    periodStart.AddDate(0, 1, 0),
+	}, nil
+}
+
+// ReserveMessage counts a message received by a user's groups against the monthly limit.
+// It returns ErrMessageLimitReached when the limit has been reached.
+func (s *UserService) ReserveMessage(id uuid.UUID) error {
+	// Get user
+	user, err := s.userRepo.GetByID(id)
+	if err != nil {
+		return err
 	}
 
-	return true, nil
+	counted, err := s.usageRepo.IncrementMessageCount(id, models.UsagePeriod(time.Now()), user.GetMessageLimit())
+	if err != nil {
+		return err
+	}
+	if !counted {
+		return ErrMessageLimitReached
+	}
+
+	return nil
+}
+
+// ReleaseMessage gives back a message reserved with ReserveMessage that was not delivered
+func (s *UserService) ReleaseMessage(id uuid.UUID) error {
+	return s.usageRepo.DecrementMessageCount(id, models.UsagePeriod(time.Now()))
 }
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ralfferreira/papo-reto/internal/auth"
+	"github.com/ralfferreira/papo-reto/internal/config"
+	"github.com/ralfferreira/papo-reto/internal/mail"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"github.com/ralfferreira/papo-reto/internal/repository"
+)
+
+// verificationTokenTTL is how long email verification links are valid
+const verificationTokenTTL = 24 * time.Hour
+
+// ErrInvalidVerificationToken is returned when a verification token cannot be used
+var ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+
+// VerificationService handles email verification
+type VerificationService struct {
+	userRepo    *repository.UserRepository
+	jwtService  *auth.JWTService
+	mailer      mail.Mailer
+	frontendURL string
+}
+
+// NewVerificationService creates a new verification service
+func NewVerificationService(userRepo *repository.UserRepository, jwtService *auth.JWTService, mailer mail.Mailer, cfg *config.Config) *VerificationService {
+	return &VerificationService{
+		userRepo:    userRepo,
+		jwtService:  jwtService,
+		mailer:      mailer,
+		frontendURL: strings.TrimRight(cfg.App.FrontendURL, "/"),
+	}
+}
+
+// SendVerification emails a verification link to a user
+func (s *VerificationService) SendVerification(ctx context.Context, user *models.User) error {
+	// Generate token
+	token, err := s.jwtService.GeneratePurposeToken(user, auth.PurposeEmailVerification, verificationTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := s.frontendURL + "/verify-email?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, mail.VerificationEmail(user.Email, user.Name, link))
+}
+
+// ResendVerification emails a new verification link to the user with an email, if they are not verified yet.
+// Unknown emails are ignored so callers cannot tell which emails have an account.
+func (s *VerificationService) ResendVerification(ctx context.Context, email string) error {
+	// Get user by email
+	user, err := s.userRepo.GetByEmail(email)
+	if err != nil || user.IsVerified {
+		return nil
+	}
+
+	return s.SendVerification(ctx, user)
+}
+
+// Verify marks the user a verification token was issued to as verified
+func (s *VerificationService) Verify(token string) (*models.User, error) {
+	// Validate token
+	claims, err := s.jwtService.ValidatePurposeToken(token, auth.PurposeEmailVerification)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	// Get user
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	// The link only verifies the address it was sent to
+	if !strings.EqualFold(user.Email, claims.Email) {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	if user.IsVerified {
+		return user, nil
+	}
+
+	// Update user
+	user.IsVerified = true
+	user.UpdatedAt = time.Now()
+
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
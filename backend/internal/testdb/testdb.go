@@ -0,0 +1,71 @@
+// Package testdb opens throwaway in-memory databases for tests
+package testdb
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ralfferreira/papo-reto/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// New opens an in-memory SQLite database with the schema of the given models.
+// Every call gets its own database, closed when the test ends.
+func New(t *testing.T, dst ...interface{}) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+
+	// Each connection to :memory: is a separate database, keep a single one
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if len(dst) == 0 {
+		dst = []interface{}{&models.User{}, &models.MessageGroup{}, &models.Message{}, &models.SharedAccess{}, &models.ThreadReply{}}
+	}
+	if err := db.AutoMigrate(dst...); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	return db
+}
+
+// Create inserts records, failing the test if one cannot be created
+func Create(t *testing.T, db *gorm.DB, records ...interface{}) {
+	t.Helper()
+
+	for _, record := range records {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatalf("failed to create %T: %v", record, err)
+		}
+	}
+}
+
+// Group creates a message group of a user
+func Group(t *testing.T, db *gorm.DB, userID uuid.UUID, slug string) *models.MessageGroup {
+	t.Helper()
+
+	group := &models.MessageGroup{UserID: userID, Name: slug, Slug: slug}
+	Create(t, db, group)
+	return group
+}
+
+// Message creates a message of a group with a moderation status
+func Message(t *testing.T, db *gorm.DB, groupID uuid.UUID, content, status string) *models.Message {
+	t.Helper()
+
+	message := &models.Message{GroupID: groupID, Content: content, ModerationStatus: status}
+	Create(t, db, message)
+	return message
+}
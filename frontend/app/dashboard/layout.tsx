@@ -38,8 +38,8 @@ export default function DashboardLayout({
     checkAuth()
   }, [router])
 
-  const handleLogout = () => {
-    authService.logout()
+  const handleLogout = async () => {
+    await authService.logout()
     router.push("/login")
   }
 
@@ -51,12 +51,13 @@ export const authService = {
    * Fazer login
    */
   login: async (data: LoginRequest) => {
-    const response = await api.post<{ token: string }>('/auth/login', data, false);
+    const response = await api.post<{ token: string; refreshToken: string }>('/auth/login', data, false);
     
-    // Se o login for bem-sucedido, salvar o token
+    // Se o login for bem-sucedido, salvar os tokens
     if (response.data?.token) {
       const localStorage = getLocalStorage();
       localStorage?.setItem('token', response.data.token);
+      localStorage?.setItem('refreshToken', response.data.refreshToken);
     }
     
     return response;
@@ -93,9 +94,13 @@ export const authService = {
   /**
    * Fazer logout
    */
-  logout: () => {
+  logout: async () => {
+    // Revogar a sessão no servidor, os tokens locais são removidos mesmo se falhar
+    await api.post<{ message: string }>('/auth/logout', {});
+
     const localStorage = getLocalStorage();
     localStorage?.removeItem('token');
+    localStorage?.removeItem('refreshToken');
   },
 
   /**
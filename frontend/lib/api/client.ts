@@ -28,12 +28,55 @@ const getLocalStorage = () => {
   return null;
 };
 
+// Renovação em andamento, compartilhada pelas requisições que receberem 401 ao mesmo tempo
+let refreshPromise: Promise<boolean> | null = null;
+
+/**
+ * Trocar o refresh token por um novo par de tokens.
+ * O refresh token só pode ser usado uma vez, então requisições simultâneas aguardam a mesma renovação.
+ */
+async function refreshTokens(): Promise<boolean> {
+  const localStorage = getLocalStorage();
+  const refreshToken = localStorage?.getItem('refreshToken');
+  if (!refreshToken) {
+    return false;
+  }
+
+  if (!refreshPromise) {
+    refreshPromise = fetch(`${API_BASE_URL}/auth/refresh`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refreshToken }),
+      mode: 'cors',
+    })
+      .then(async (response) => {
+        if (!response.ok) {
+          localStorage?.removeItem('token');
+          localStorage?.removeItem('refreshToken');
+          return false;
+        }
+
+        const data = await response.json();
+        localStorage?.setItem('token', data.token);
+        localStorage?.setItem('refreshToken', data.refreshToken);
+        return true;
+      })
+      .catch(() => false)
+      .finally(() => {
+        refreshPromise = null;
+      });
+  }
+
+  return refreshPromise;
+}
+
 /**
  * Função para fazer requisições HTTP para a API
  */
 export async function apiRequest<T>(
   endpoint: string,
-  options: RequestOptions
+  options: RequestOptions,
+  retry = true
 ): Promise<ApiResponse<T>> {
   const { method, body, requiresAuth = true } = options;
 
@@ -69,6 +112,11 @@ export async function apiRequest<T>(
     // Fazer a requisição
     const response = await fetch(`${API_BASE_URL}${endpoint}`, requestConfig);
 
+    // Token de acesso expirado, renovar e tentar novamente uma vez
+    if (response.status === 401 && requiresAuth && retry && (await refreshTokens())) {
+      return apiRequest<T>(endpoint, options, false);
+    }
+
     // Tentar obter dados da resposta como JSON
     let data;
     const contentType = response.headers.get('content-type');